@@ -0,0 +1,241 @@
+package arc
+
+import (
+	"container/list"
+	"time"
+)
+
+// 记录所在的链表
+const (
+	t1 = iota //最近只被访问过一次的记录
+	t2        //最近被访问过至少两次的记录
+	b1        //从 t1 淘汰的幽灵记录，只保留 key 和大小
+	b2        //从 t2 淘汰的幽灵记录，只保留 key 和大小
+)
+
+/*
+ARCCache 实现了自适应替换缓存（Adaptive Replacement Cache）淘汰算法，容量按字节计算：
+t1、t2：保存真实记录的两个 LRU 链表，t1 中的记录最近只被访问过一次，t2 中的记录最近被访问过至少两次，
+t1 中的记录再次被访问后移动到 t2，所以一次性扫描的大量冷 key 只会挤占 t1，不会影响 t2 中的热点 key；
+b1、b2：幽灵链表，分别记录最近从 t1、t2 淘汰的 key 和大小，不保存值；
+p：t1 的目标容量。写入的 key 命中 b1 说明 t1 太小，增大 p；命中 b2 说明 t2 太小，减小 p，
+算法根据访问模式在"最近使用"和"经常使用"之间自动调整，不需要手动设置参数；
+cache：map，键是字符串，值是 t1、t2 中对应节点的指针；ghosts：map，键是字符串，值是 b1、b2 中对应节点的指针；
+OnEvicted：是某条真实记录被移除时的回调函数，可以为 nil。
+*/
+type ARCCache struct {
+	maxBytes  int64
+	nBytes    int64
+	p         int64
+	lists     [4]*list.List
+	bytes     [4]int64
+	cache     map[string]*list.Element
+	ghosts    map[string]*list.Element
+	OnEvicted func(key string, value Value)
+}
+
+type Value interface {
+	Len() int
+} // 为了通用性，我们允许值是实现了 Value 接口的任意类型，该接口只包含了一个方法 Len() int，用于返回值所占用的内存大小。
+
+type entry struct {
+	key    string
+	value  Value     //幽灵记录的值为 nil
+	size   int64     //记录占用的容量，幽灵记录保留被淘汰时的大小
+	expire time.Time //节点的过期时间
+	list   int       //节点所在的链表
+}
+
+// New 通过传入maxBytes,onEvicted这些参数，返回一个ARCCache结构体。maxBytes 为 0 时不限制容量，也不会淘汰任何记录。
+func New(maxBytes int64, onEvicted func(string, Value)) *ARCCache {
+	c := &ARCCache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*list.Element),
+		ghosts:    make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	return c
+}
+
+// Get 函数用于根据键获取缓存中的值。命中 t1 中的记录时将其移动到 t2，命中 t2 中的记录时将其移动到 t2 的最前面；
+// 如果键不存在或者键已经过期，则返回零值和 false。
+func (c *ARCCache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	if kv.expire.Before(time.Now()) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	c.moveToFront(ele, t2)
+	return kv.value, true
+}
+
+// Add 方法用于向缓存中添加新的键值对，键值对在 ttl 之后过期，等价于 AddWithExpire(key, value, time.Now().Add(ttl))。
+func (c *ARCCache) Add(key string, value Value, ttl time.Duration) {
+	c.AddWithExpire(key, value, time.Now().Add(ttl))
+}
+
+/*
+AddWithExpire 方法用于向缓存中添加新的键值对，键值对在 expireTime 过期。
+已存在的记录原地更新并视为一次访问，移动到 t2；
+命中幽灵链表 b1 或 b2 的 key 先调整 t1 的目标容量 p，调整的幅度与另一个幽灵链表的相对大小成正比，然后直接进入 t2；
+其他新的记录进入 t1。大于 maxBytes 的值不会被缓存，同名的旧值也会被删除。
+*/
+func (c *ARCCache) AddWithExpire(key string, value Value, expireTime time.Time) {
+	size := int64(len(key)) + int64(value.Len())
+	if c.maxBytes != 0 && size > c.maxBytes {
+		c.Remove(key)
+		return
+	}
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.nBytes += size - kv.size
+		c.bytes[kv.list] += size - kv.size
+		kv.value, kv.size, kv.expire = value, size, expireTime
+		c.moveToFront(ele, t2)
+		c.replace(0, false)
+		c.trimGhosts()
+		return
+	}
+	kv := &entry{key: key, value: value, size: size, expire: expireTime, list: t1}
+	if ele, ok := c.ghosts[key]; ok {
+		ghost := ele.Value.(*entry)
+		if ghost.list == b1 {
+			c.p = min64(c.maxBytes, c.p+size*max64(c.bytes[b2]/max64(c.bytes[b1], 1), 1))
+		} else {
+			c.p = max64(0, c.p-size*max64(c.bytes[b1]/max64(c.bytes[b2], 1), 1))
+		}
+		c.detach(ele)
+		c.replace(size, ghost.list == b2)
+		kv.list = t2
+	} else {
+		c.replace(size, false)
+	}
+	c.cache[key] = c.lists[kv.list].PushFront(kv)
+	c.bytes[kv.list] += size
+	c.nBytes += size
+	c.trimGhosts()
+}
+
+// replace 方法淘汰真实记录，直到能再放下 size 大小的记录：t1 超过目标容量 p 时淘汰 t1 中最久未使用的记录，否则淘汰 t2 中的记录，
+// 被淘汰的 key 进入对应的幽灵链表。inB2 表示本次写入命中了 b2，此时 t1 等于 p 也优先淘汰 t1。
+func (c *ARCCache) replace(size int64, inB2 bool) {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.nBytes+size > c.maxBytes {
+		from, to := t2, b2
+		if c.lists[t1].Len() > 0 && (c.bytes[t1] > c.p || (inB2 && c.bytes[t1] == c.p) || c.lists[t2].Len() == 0) {
+			from, to = t1, b1
+		}
+		kv := c.detach(c.lists[from].Back())
+		c.evicted(kv)
+		kv.value, kv.list = nil, to
+		c.ghosts[kv.key] = c.lists[to].PushFront(kv)
+		c.bytes[to] += kv.size
+	}
+}
+
+// trimGhosts 方法限制幽灵链表的大小：t1 与 b1 之和不超过 maxBytes，四个链表之和不超过 2 倍的 maxBytes
+func (c *ARCCache) trimGhosts() {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.lists[b1].Len() > 0 && c.bytes[t1]+c.bytes[b1] > c.maxBytes {
+		c.detach(c.lists[b1].Back())
+	}
+	for c.lists[b2].Len() > 0 && c.nBytes+c.bytes[b1]+c.bytes[b2] > 2*c.maxBytes {
+		c.detach(c.lists[b2].Back())
+	}
+}
+
+// Remove 方法用于主动删除某个键，同时删除对应的幽灵记录，键不存在时什么也不做。
+func (c *ARCCache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+	if ele, ok := c.ghosts[key]; ok {
+		c.detach(ele)
+	}
+}
+
+// Len 方法返回当前缓存中真实记录的数量，不包括幽灵记录。
+func (c *ARCCache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes 方法返回当前真实记录已占用的容量。
+func (c *ARCCache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Clear 方法清空缓存中的所有记录和幽灵记录，不会调用 OnEvicted。
+func (c *ARCCache) Clear() {
+	for i := range c.lists {
+		c.lists[i].Init()
+		c.bytes[i] = 0
+	}
+	c.cache = make(map[string]*list.Element)
+	c.ghosts = make(map[string]*list.Element)
+	c.nBytes, c.p = 0, 0
+}
+
+// moveToFront 将真实记录移动到链表 to 的最前面
+func (c *ARCCache) moveToFront(ele *list.Element, to int) {
+	kv := ele.Value.(*entry)
+	if kv.list == to {
+		c.lists[to].MoveToFront(ele)
+		return
+	}
+	c.lists[kv.list].Remove(ele)
+	c.bytes[kv.list] -= kv.size
+	kv.list = to
+	c.cache[kv.key] = c.lists[to].PushFront(kv)
+	c.bytes[to] += kv.size
+}
+
+// detach 将节点从所在的链表和 map 中取出，返回对应的记录，不调用 OnEvicted
+func (c *ARCCache) detach(ele *list.Element) *entry {
+	kv := ele.Value.(*entry)
+	c.lists[kv.list].Remove(ele)
+	c.bytes[kv.list] -= kv.size
+	if kv.list == t1 || kv.list == t2 {
+		delete(c.cache, kv.key)
+		c.nBytes -= kv.size
+	} else {
+		delete(c.ghosts, kv.key)
+	}
+	return kv
+}
+
+// removeElement 函数用于删除某个真实记录，不会留下幽灵记录
+func (c *ARCCache) removeElement(ele *list.Element) {
+	c.evicted(c.detach(ele))
+}
+
+// evicted 调用记录被移除时的回调函数
+func (c *ARCCache) evicted(kv *entry) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
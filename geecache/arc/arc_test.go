@@ -0,0 +1,150 @@
+package arc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+// key 和 value 的长度之和为 10，方便计算容量
+func key(i int) string {
+	return fmt.Sprintf("k%03d", i)
+}
+
+var value = String("012345")
+
+func TestGet(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key1", String("1234"), time.Minute)
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+	c.AddWithExpire("key3", String("1234"), time.Now().Add(-time.Second))
+	if _, ok := c.Get("key3"); ok || c.Len() != 1 {
+		t.Fatalf("expired key3 should be removed")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key", String("1"), time.Minute)
+	c.Add("key", String("111"), time.Minute)
+	if c.Bytes() != int64(len("key")+len("111")) {
+		t.Fatal("expected 6 but got", c.Bytes())
+	}
+	c.Remove("key")
+	if c.Len() != 0 || c.Bytes() != 0 {
+		t.Fatalf("Remove key failed")
+	}
+	c = New(int64(10), nil)
+	c.Add("k", String("0123456789"), time.Minute)
+	if _, ok := c.Get("k"); ok || c.Bytes() != 0 {
+		t.Fatalf("value larger than maxBytes should not be cached")
+	}
+}
+
+// 从 t1 淘汰的 key 进入 b1，再次写入时增大 p 并直接进入 t2
+func TestGhostB1(t *testing.T) {
+	var evicted []string
+	c := New(int64(40), func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	c.Add(key(0), value, time.Minute)
+	c.Get(key(0)) //访问两次，进入 t2
+	for i := 1; i < 5; i++ {
+		c.Add(key(i), value, time.Minute)
+	}
+	if len(evicted) != 1 || evicted[0] != key(1) || c.ghosts[key(1)] == nil || c.ghosts[key(1)].Value.(*entry).list != b1 {
+		t.Fatalf("k1 should be evicted from t1 into b1, evicted %v", evicted)
+	}
+	if _, ok := c.Get(key(1)); ok {
+		t.Fatalf("ghost entry should not be returned")
+	}
+
+	c.Add(key(1), value, time.Minute)
+	if c.p != 10 {
+		t.Fatalf("b1 hit should increase p to 10, but got %d", c.p)
+	}
+	if c.cache[key(1)].Value.(*entry).list != t2 || c.ghosts[key(1)] != nil {
+		t.Fatalf("k1 should move from b1 to t2")
+	}
+	if c.ghosts[key(2)] == nil || c.Len() != 4 || c.Bytes() != 40 || c.bytes[t2] != 20 || c.bytes[b1] != 10 {
+		t.Fatalf("unexpected state: len %d, bytes %d, t2 %d, b1 %d", c.Len(), c.Bytes(), c.bytes[t2], c.bytes[b1])
+	}
+}
+
+// t1 占满整个缓存时，从 t1 淘汰的 key 不再保留幽灵记录，保证 t1 与 b1 之和不超过 maxBytes
+func TestGhostB1Limit(t *testing.T) {
+	c := New(int64(40), nil)
+	for i := 0; i < 5; i++ {
+		c.Add(key(i), value, time.Minute)
+	}
+	if c.Len() != 4 || len(c.ghosts) != 0 {
+		t.Fatalf("b1 should be empty when t1 is full, but got %d ghosts", len(c.ghosts))
+	}
+}
+
+// 从 t2 淘汰的 key 进入 b2，再次写入时减小 p
+func TestGhostB2(t *testing.T) {
+	c := New(int64(40), nil)
+	for i := 0; i < 4; i++ {
+		c.Add(key(i), value, time.Minute)
+		c.Get(key(i)) //访问两次，进入 t2
+	}
+	c.Add(key(4), value, time.Minute)
+	c.Add(key(5), value, time.Minute) //t1 没有超过 p，淘汰 t2 中最久未使用的 k0
+	if ele := c.ghosts[key(0)]; ele == nil || ele.Value.(*entry).list != b2 {
+		t.Fatalf("k0 should be evicted from t2 into b2")
+	}
+	c.p = 20
+	c.Add(key(0), value, time.Minute)
+	if c.p != 10 {
+		t.Fatalf("b2 hit should decrease p to 10, but got %d", c.p)
+	}
+	if c.cache[key(0)].Value.(*entry).list != t2 {
+		t.Fatalf("k0 should move from b2 to t2")
+	}
+}
+
+// 一次性扫描的大量冷 key 只会挤占 t1，t2 中的热点 key 不受影响，幽灵链表的大小也有上限
+func TestScanResistance(t *testing.T) {
+	c := New(int64(100), nil)
+	for i := 0; i < 5; i++ {
+		c.Add(key(i), value, time.Minute)
+		c.Get(key(i))
+	}
+	for i := 100; i < 1100; i++ {
+		c.Add(key(i), String(value[:len(value)-2]), time.Minute)
+		if c.Bytes() > 100 || c.bytes[t1]+c.bytes[b1] > 100 || c.Bytes()+c.bytes[b1]+c.bytes[b2] > 200 {
+			t.Fatalf("capacity exceeded: bytes %d, b1 %d, b2 %d", c.Bytes(), c.bytes[b1], c.bytes[b2])
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := c.Get(key(i)); !ok {
+			t.Fatalf("hot key %s should survive the scan", key(i))
+		}
+	}
+	if len(c.ghosts) != c.lists[b1].Len()+c.lists[b2].Len() {
+		t.Fatalf("ghosts map and ghost lists are inconsistent")
+	}
+}
+
+func TestClear(t *testing.T) {
+	c := New(int64(20), nil)
+	for i := 0; i < 3; i++ {
+		c.Add(key(i), value, time.Minute)
+	}
+	c.Clear()
+	if _, ok := c.Get(key(2)); ok || c.Len() != 0 || c.Bytes() != 0 || len(c.ghosts) != 0 || c.p != 0 {
+		t.Fatalf("Clear failed")
+	}
+}
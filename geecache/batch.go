@@ -0,0 +1,249 @@
+package geecache
+
+import (
+	pb "Geecache/geecache/geecachepb"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// BatchGetter 是可以一次加载多个 key 的 GetterCtx，GetMulti 发现数据源实现了该接口时，
+// 把本地缺失的 key 合并成一次 GetBatch 查询，例如一条 SELECT ... WHERE id IN (...)。
+// 返回的 map 中没有的 key 视为不存在，与 Get 返回 ErrNotFound 相同；返回错误时所有 key 都获取失败。
+// 批量查询的结果使用缓存组默认的过期时间，数据源同时实现了 ExpiringGetter 时不会使用 GetBatch。
+type BatchGetter interface {
+	GetterCtx
+	GetBatch(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+// BatchPeerGetter 是支持一次获取多个 key 的 PeerGetter，GetMulti 把同一个拥有者的 key 合并成一次 GetBatch 请求。
+// out.Items 的顺序与 in.Keys 相同。不支持批量获取的远程节点会按 key 逐个获取。
+type BatchPeerGetter interface {
+	PeerGetter
+	GetBatch(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error
+}
+
+// errBatchUnsupported 表示远程节点不支持 GetBatch
+var errBatchUnsupported = errors.New("peer does not support GetBatch")
+
+// ErrPeer 表示拥有该 key 的远程节点在批量获取时返回了该 key 的错误，通常是远程节点访问数据源失败。
+// GetMulti 返回的错误满足 errors.Is(err, ErrPeer) 时，可以稍后重试
+var ErrPeer = errors.New("peer error")
+
+// maxConcurrentLoads 是 GetMulti 同时逐个加载的 key 的最大数量，包括批量获取失败后的回退和从数据源的加载
+const maxConcurrentLoads = 8
+
+/*
+GetMulti 一次获取多个 key，返回存在的 key 及其缓存值，数据源中不存在的 key 不会出现在结果中。
+key 被分为三类：本地缓存命中的 key 直接返回；属于远程节点的 key 按拥有者分组，每个拥有者并发地发送一次 GetBatch；
+属于当前节点的缺失的 key 从数据源加载，数据源实现了 BatchGetter 时只查询一次。
+批量请求失败的拥有者会退回到按 key 逐个获取，与 Get 一样会尝试备选节点。
+部分 key 获取失败时仍然返回其他 key 的结果，error 汇总了所有失败的 key。
+*/
+func (g *Group) GetMulti(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	values, errs := g.getMulti(ctx, keys)
+	var failed []error
+	for _, key := range keys {
+		if err, ok := errs[key]; ok && !errors.Is(err, ErrNotFound) {
+			failed = append(failed, err)
+			delete(errs, key) //重复的 key 只报告一次
+		}
+	}
+	return values, errors.Join(failed...)
+}
+
+// getMulti 是 GetMulti 的实现，返回每个 key 的缓存值或者错误，key 不存在时错误满足 errors.Is(err, ErrNotFound)
+func (g *Group) getMulti(ctx context.Context, keys []string) (map[string]ByteView, map[string]error) {
+	values := make(map[string]ByteView, len(keys))
+	errs := make(map[string]error)
+	var misses []string
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if key == "" {
+			errs[key] = fmt.Errorf("key is required")
+			continue
+		}
+		if v, ok := g.hotCache.get(key); ok {
+			g.maybeReload(key, v, true)
+			values[key] = v
+			continue
+		}
+		if v, ok := g.mainCache.get(key); ok {
+			g.maybeReload(key, v, false)
+			values[key] = v
+			continue
+		}
+		if g.negative.has(key) {
+			errs[key] = notFound(key)
+			continue
+		}
+		misses = append(misses, key)
+	}
+	local := misses
+	if g.peers != nil && !isPeerRequest(ctx) && len(misses) > 0 {
+		local = g.getMultiFromPeers(ctx, misses, values, errs)
+	}
+	g.getMultiLocally(ctx, local, values, errs)
+	return values, errs
+}
+
+// peerBatch 是发给同一个拥有者的一批 key
+type peerBatch struct {
+	peer PeerGetter
+	keys []string
+	resp *pb.BatchResponse
+	err  error
+}
+
+// getMultiFromPeers 按拥有者分组，并发地从远程节点批量获取 keys，结果写入 values 和 errs，返回属于当前节点的 key
+func (g *Group) getMultiFromPeers(ctx context.Context, keys []string, values map[string]ByteView, errs map[string]error) (local []string) {
+	var batches []*peerBatch
+	byPeer := make(map[PeerGetter]*peerBatch)
+	for _, key := range keys {
+		peer, ok := g.peers.PickPeer(key)
+		if !ok {
+			local = append(local, key)
+			continue
+		}
+		b, ok := byPeer[peer]
+		if !ok {
+			b = &peerBatch{peer: peer}
+			byPeer[peer] = b
+			batches = append(batches, b)
+		}
+		b.keys = append(b.keys, key)
+	}
+	var wg sync.WaitGroup
+	for _, b := range batches {
+		bp, ok := b.peer.(BatchPeerGetter)
+		if !ok {
+			b.err = errBatchUnsupported
+			continue
+		}
+		wg.Add(1)
+		go func(b *peerBatch) {
+			defer wg.Done()
+			b.resp = &pb.BatchResponse{}
+			b.err = bp.GetBatch(ctx, &pb.BatchRequest{Group: g.name, Keys: b.keys}, b.resp)
+			if b.err == nil && len(b.resp.Items) != len(b.keys) {
+				b.err = fmt.Errorf("batch response has %d items, expect %d", len(b.resp.Items), len(b.keys))
+			}
+		}(b)
+	}
+	wg.Wait()
+	//批量获取失败或者缓存值太大的 key 需要逐个获取，与 Get 一样会尝试备选节点或者回退到本地
+	var fallback []string
+	for _, b := range batches { //values 和 errs 不是并发安全的，在当前协程中处理结果
+		if b.err != nil {
+			if b.err != errBatchUnsupported {
+				log.Println("[GeeCache] Failed to get batch from peer", b.err)
+			}
+			fallback = append(fallback, b.keys...)
+			continue
+		}
+		for i, key := range b.keys {
+			item := b.resp.Items[i]
+			if item.Error != "" {
+				errs[key] = fmt.Errorf("%s: %w: %s", key, ErrPeer, item.Error)
+				continue
+			}
+			if item.TooLarge { //缓存值没有放在批量响应中，单独获取
+				fallback = append(fallback, key)
+				continue
+			}
+			if item.Response == nil {
+				errs[key] = fmt.Errorf("%s: empty response", key)
+				continue
+			}
+			if v, err := g.peerView(key, item.Response); err == nil {
+				values[key] = v
+			} else {
+				errs[key] = err
+			}
+		}
+	}
+	g.loadKeys(ctx, fallback, g.load, values, errs)
+	return local
+}
+
+/*
+getMultiLocally 从数据源加载属于当前节点的 keys，每个 key 都经过 singleflight，与同时到来的 Get 共享加载。
+数据源实现了 BatchGetter 时，第一个开始加载的 key 把所有 keys 合并成一次查询，其余的 key 等待这次查询的结果；
+数据源同时实现了 ExpiringGetter 时，为了使用每个 key 自己的过期时间，仍然逐个加载。
+*/
+func (g *Group) getMultiLocally(ctx context.Context, keys []string, values map[string]ByteView, errs map[string]error) {
+	if len(keys) == 0 {
+		return
+	}
+	load := g.load
+	if bg, ok := g.getter.(BatchGetter); ok {
+		if _, expiring := g.getter.(ExpiringGetter); !expiring {
+			load = g.batchLoader(bg, keys)
+		}
+	}
+	g.loadKeys(ctx, keys, load, values, errs)
+}
+
+// loadKeys 并发地调用 load 加载 keys，最多同时加载 maxConcurrentLoads 个 key，结果写入 values 和 errs
+func (g *Group) loadKeys(ctx context.Context, keys []string, load func(ctx context.Context, key string) (ByteView, error), values map[string]ByteView, errs map[string]error) {
+	views := make([]ByteView, len(keys))
+	loadErrs := make([]error, len(keys))
+	sem := make(chan struct{}, maxConcurrentLoads)
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			views[i], loadErrs[i] = load(ctx, key)
+		}(i, key)
+	}
+	wg.Wait()
+	for i, key := range keys {
+		if loadErrs[i] != nil {
+			errs[key] = loadErrs[i]
+		} else {
+			values[key] = views[i]
+		}
+	}
+}
+
+// batchLoader 返回与 g.load 签名相同的加载函数，keys 共享同一次 GetBatch 查询，查询只在第一个 key 真正开始加载时执行一次。
+// 与 g.load 一样，查询使用该 key 的共享加载的 ctx，并且不超过 g.timeout
+func (g *Group) batchLoader(bg BatchGetter, keys []string) func(ctx context.Context, key string) (ByteView, error) {
+	var once sync.Once
+	var found map[string][]byte
+	var batchErr error
+	return func(ctx context.Context, key string) (ByteView, error) {
+		view, err := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+			once.Do(func() {
+				ctx, cancel := context.WithTimeout(ctx, g.timeout)
+				defer cancel()
+				found, batchErr = bg.GetBatch(ctx, keys)
+			})
+			if batchErr != nil {
+				return nil, batchErr
+			}
+			bytes, ok := found[key]
+			if !ok {
+				g.negative.add(key)
+				return nil, notFound(key)
+			}
+			value := ByteView{b: cloneBytes(bytes), t: time.Now(), e: g.expireAt(0)}
+			g.populateCache(key, value)
+			return value, nil
+		})
+		if err != nil {
+			return ByteView{}, err
+		}
+		return view.(ByteView), nil
+	}
+}
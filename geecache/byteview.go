@@ -1,7 +1,15 @@
 package geecache
 
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
 type ByteView struct {
-	b []byte //b 将会存储真实的缓存值。选择 byte 类型是为了能够支持任意的数据类型的存储，例如字符串、图片等。
+	b []byte    //b 将会存储真实的缓存值。选择 byte 类型是为了能够支持任意的数据类型的存储，例如字符串、图片等。
+	t time.Time //t 是缓存值从数据源或远程节点加载的时间，用于判断是否超过软过期时间，零值表示未知
+	e time.Time //e 是缓存值的过期时间，来自数据源或默认的过期时间，会随响应传给其他节点，零值表示未知
 }
 
 func (v ByteView) Len() int {
@@ -16,6 +24,10 @@ func (v ByteView) String() string {
 	return string(v.b)
 } //返回string类型的缓存值
 
+func (v ByteView) Reader() io.Reader {
+	return bytes.NewReader(v.b)
+} //返回读取缓存值的 io.Reader，不会拷贝缓存值，适合图片等较大的缓存值，读取方也无法修改缓存值。
+
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
@@ -1,81 +1,321 @@
 package geecache
 
 import (
+	"Geecache/geecache/arc"
 	"Geecache/geecache/lfu"
 	"Geecache/geecache/lru"
+	"Geecache/geecache/tinylfu"
+	"Geecache/geecache/twoq"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 )
 
-// BaseCache 是一个接口，定义了基本的缓存操作方法。它包含了两个方法：add 和 get，用于向缓存中添加数据和从缓存中获取数据。
+// BaseCache 是一个接口，定义了基本的缓存操作方法。它包含了三个方法：add、get 和 remove，用于向缓存中添加数据、从缓存中获取数据和从缓存中删除数据。
+// add 使用 value.e 作为过期时间，由 Group 根据数据源返回的过期时间或默认的过期时间设置。
 type BaseCache interface {
 	add(key string, value ByteView)
 	get(key string) (value ByteView, ok bool)
+	remove(key string)
 }
 
-// LRUcache 的实现非常简单，实例化 lru，封装 get 和 add 方法。
-type LRUcache struct {
-	mu         sync.RWMutex // 读写锁
-	lru        *lru.LRUCache
-	cacheBytes int64         // lru的maxBytes
-	ttl        time.Duration // lru的defaultTTL
+/*
+Cache 是缓存淘汰算法需要实现的接口，通过 RegisterPolicy 注册后即可在 WithPolicy 中按名称使用，
+mainCache 和 hotCache 都由注册的算法创建。实现不需要并发安全，Group 会在锁的保护下调用它的方法。
+Get：返回未过期的缓存值，过期的记录应当被删除并返回 false；
+Add：添加或更新缓存值，value 在 expire 之后过期。超过容量时由实现决定淘汰哪些记录；
+Remove：删除某个键，键不存在时什么也不做；
+Len：返回记录数量；
+Bytes：返回已占用的容量，即所有键和值的长度之和；
+Clear：清空所有记录。
+*/
+type Cache interface {
+	Get(key string) (value ByteView, ok bool)
+	Add(key string, value ByteView, expire time.Time)
+	Remove(key string)
+	Len() int
+	Bytes() int64
+	Clear()
+}
+
+// PolicyFactory 创建一个容量为 maxBytes 的 Cache，maxBytes 为 0 表示不限制容量。
+// 记录因淘汰、过期或删除而被移除时调用 onEvicted，onEvicted 可以为 nil
+type PolicyFactory func(maxBytes int64, onEvicted func(key string, value ByteView)) Cache
+
+var (
+	policiesMu sync.RWMutex
+	policies   = map[string]PolicyFactory{ //根据名称获取淘汰算法
+		"lru":     newLRUCache,
+		"lfu":     newLFUCache,
+		"tinylfu": newTinyLFUCache,
+		"arc":     newARCCache,
+		"2q":      newTwoQueueCache,
+	}
+)
+
+// RegisterPolicy 以 name 注册一个缓存淘汰算法，通常在 init 函数中调用。
+// name 已经被注册或者 factory 为 nil 时 panic
+func RegisterPolicy(name string, factory PolicyFactory) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	if factory == nil {
+		panic("geecache: RegisterPolicy factory is nil")
+	}
+	if _, dup := policies[name]; dup {
+		panic(fmt.Sprintf("geecache: RegisterPolicy called twice for policy %q", name))
+	}
+	policies[name] = factory
+}
+
+// Policies 返回所有已注册的淘汰算法的名称，按名称排序
+func Policies() []string {
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupPolicy 根据名称获取淘汰算法
+func lookupPolicy(name string) (PolicyFactory, bool) {
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+	factory, ok := policies[name]
+	return factory, ok
+}
+
+// syncCache 为 Cache 加上互斥锁，实现 BaseCache。
+// 淘汰算法的 Get 也会修改内部状态（例如移动链表节点），所以读写都使用同一把互斥锁，而不是读写锁。
+type syncCache struct {
+	mu        sync.Mutex
+	cache     Cache
+	factory   PolicyFactory
+	maxBytes  int64
+	onEvicted func(key string, value ByteView)
+}
+
+// newSyncCache 创建一个使用 factory 的 syncCache
+func newSyncCache(factory PolicyFactory, maxBytes int64, onEvicted func(key string, value ByteView)) *syncCache {
+	return &syncCache{factory: factory, maxBytes: maxBytes, onEvicted: onEvicted}
 }
 
 // add 函数用于向缓存中添加数据
-func (c *LRUcache) add(key string, value ByteView) {
-	c.mu.Lock() //写锁
+func (c *syncCache) add(key string, value ByteView) {
+	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil, c.ttl)
+	if c.cache == nil {
+		c.cache = c.factory(c.maxBytes, c.onEvicted)
 	}
 	/*
-		判断c.lru 是否为 nil，如果等于 nil 再创建实例。
+		判断c.cache 是否为 nil，如果等于 nil 再创建实例。
 		这种方法称之为延迟初始化(Lazy Initialization)，一个对象的延迟初始化意味着该对象的创建将会延迟至第一次使用该对象时。
 		主要用于提高性能，并减少程序内存要求。
 	.*/
-	c.lru.Add(key, value, c.ttl)
+	c.cache.Add(key, value, value.e)
 }
 
 // get 函数用于从缓存中获取数据
-func (c *LRUcache) get(key string) (value ByteView, ok bool) {
-	c.mu.RLock() //读锁
-	defer c.mu.RUnlock()
-	if c.lru == nil {
+func (c *syncCache) get(key string) (value ByteView, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cache == nil {
 		return
 	}
-	if v, ok := c.lru.Get(key); ok {
-		return v.(ByteView), ok
-	}
-	return
+	return c.cache.Get(key)
 }
 
-// LFUcache 同理于LRUcache
-type LFUcache struct {
-	mu         sync.RWMutex
-	lfu        *lfu.LFUCache
-	cacheBytes int64
-	ttl        time.Duration
+// removeExpired 函数清理最多 limit 条过期记录，缓存没有实现 Expirer 时什么也不做
+func (c *syncCache) removeExpired(limit int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.cache.(Expirer); ok {
+		return e.RemoveExpired(limit)
+	}
+	return 0
 }
 
-// add 函数用于向缓存中添加数据
-func (c *LFUcache) add(key string, value ByteView) {
+// remove 函数用于从缓存中删除数据
+func (c *syncCache) remove(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lfu == nil {
-		c.lfu = lfu.New(c.cacheBytes, nil, c.ttl)
+	if c.cache == nil {
+		return
 	}
-	c.lfu.Add(key, value, c.ttl)
+	c.cache.Remove(key)
 }
 
-// get 函数用于从缓存中获取数据
-func (c *LFUcache) get(key string) (value ByteView, ok bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	if c.lfu == nil {
-		return
+// lruCache 将 lru.LRUCache 适配为 Cache
+type lruCache struct {
+	lru *lru.LRUCache
+}
+
+// newLRUCache 是 lru 算法的 PolicyFactory
+func newLRUCache(maxBytes int64, onEvicted func(key string, value ByteView)) Cache {
+	c := &lruCache{lru: lru.New(maxBytes, nil)}
+	if onEvicted != nil {
+		c.lru.OnEvicted = func(key string, value lru.Value) {
+			onEvicted(key, value.(ByteView))
+		}
 	}
+	return c
+}
+
+func (c *lruCache) Get(key string) (value ByteView, ok bool) {
+	if v, ok := c.lru.Get(key); ok {
+		return v.(ByteView), true
+	}
+	return
+}
+
+func (c *lruCache) Add(key string, value ByteView, expire time.Time) {
+	c.lru.AddWithExpire(key, value, expire)
+}
+
+func (c *lruCache) Remove(key string) { c.lru.Remove(key) }
+func (c *lruCache) Len() int          { return c.lru.Len() }
+func (c *lruCache) Bytes() int64      { return c.lru.Bytes() }
+func (c *lruCache) Clear()            { c.lru.Clear() }
+
+func (c *lruCache) RemoveExpired(limit int) int {
+	return c.lru.RemoveExpired(limit)
+}
+
+// lfuCache 同理于 lruCache
+type lfuCache struct {
+	lfu *lfu.LFUCache
+}
+
+// lfuDecayInterval 是 lfu 算法的频率衰减周期，避免过去的热点一直占据缓存
+const lfuDecayInterval = time.Minute
+
+// newLFUCache 是 lfu 算法的 PolicyFactory
+func newLFUCache(maxBytes int64, onEvicted func(key string, value ByteView)) Cache {
+	c := &lfuCache{lfu: lfu.New(maxBytes, nil)}
+	c.lfu.SetDecay(lfuDecayInterval)
+	if onEvicted != nil {
+		c.lfu.OnEvicted = func(key string, value lfu.Value) {
+			onEvicted(key, value.(ByteView))
+		}
+	}
+	return c
+}
+
+func (c *lfuCache) Get(key string) (value ByteView, ok bool) {
 	if v, ok := c.lfu.Get(key); ok {
-		return v.(ByteView), ok
+		return v.(ByteView), true
 	}
 	return
 }
+
+func (c *lfuCache) Add(key string, value ByteView, expire time.Time) {
+	c.lfu.AddWithExpire(key, value, expire)
+}
+
+func (c *lfuCache) Remove(key string) { c.lfu.Remove(key) }
+func (c *lfuCache) Len() int          { return c.lfu.Len() }
+func (c *lfuCache) Bytes() int64      { return c.lfu.Bytes() }
+func (c *lfuCache) Clear()            { c.lfu.Clear() }
+
+func (c *lfuCache) RemoveExpired(limit int) int {
+	return c.lfu.RemoveExpired(limit)
+}
+
+// tinylfuCache 同理于 lruCache
+type tinylfuCache struct {
+	tinylfu *tinylfu.TinyLFU
+}
+
+// newTinyLFUCache 是 W-TinyLFU 算法的 PolicyFactory
+func newTinyLFUCache(maxBytes int64, onEvicted func(key string, value ByteView)) Cache {
+	c := &tinylfuCache{tinylfu: tinylfu.New(maxBytes, nil)}
+	if onEvicted != nil {
+		c.tinylfu.OnEvicted = func(key string, value tinylfu.Value) {
+			onEvicted(key, value.(ByteView))
+		}
+	}
+	return c
+}
+
+func (c *tinylfuCache) Get(key string) (value ByteView, ok bool) {
+	if v, ok := c.tinylfu.Get(key); ok {
+		return v.(ByteView), true
+	}
+	return
+}
+
+func (c *tinylfuCache) Add(key string, value ByteView, expire time.Time) {
+	c.tinylfu.AddWithExpire(key, value, expire)
+}
+
+func (c *tinylfuCache) Remove(key string) { c.tinylfu.Remove(key) }
+func (c *tinylfuCache) Len() int          { return c.tinylfu.Len() }
+func (c *tinylfuCache) Bytes() int64      { return c.tinylfu.Bytes() }
+func (c *tinylfuCache) Clear()            { c.tinylfu.Clear() }
+
+// arcCache 同理于 lruCache
+type arcCache struct {
+	arc *arc.ARCCache
+}
+
+// newARCCache 是 ARC 算法的 PolicyFactory
+func newARCCache(maxBytes int64, onEvicted func(key string, value ByteView)) Cache {
+	c := &arcCache{arc: arc.New(maxBytes, nil)}
+	if onEvicted != nil {
+		c.arc.OnEvicted = func(key string, value arc.Value) {
+			onEvicted(key, value.(ByteView))
+		}
+	}
+	return c
+}
+
+func (c *arcCache) Get(key string) (value ByteView, ok bool) {
+	if v, ok := c.arc.Get(key); ok {
+		return v.(ByteView), true
+	}
+	return
+}
+
+func (c *arcCache) Add(key string, value ByteView, expire time.Time) {
+	c.arc.AddWithExpire(key, value, expire)
+}
+
+func (c *arcCache) Remove(key string) { c.arc.Remove(key) }
+func (c *arcCache) Len() int          { return c.arc.Len() }
+func (c *arcCache) Bytes() int64      { return c.arc.Bytes() }
+func (c *arcCache) Clear()            { c.arc.Clear() }
+
+// twoQueueCache 同理于 lruCache
+type twoQueueCache struct {
+	twoq *twoq.TwoQueueCache
+}
+
+// newTwoQueueCache 是 2Q 算法的 PolicyFactory
+func newTwoQueueCache(maxBytes int64, onEvicted func(key string, value ByteView)) Cache {
+	c := &twoQueueCache{twoq: twoq.New(maxBytes, nil)}
+	if onEvicted != nil {
+		c.twoq.OnEvicted = func(key string, value twoq.Value) {
+			onEvicted(key, value.(ByteView))
+		}
+	}
+	return c
+}
+
+func (c *twoQueueCache) Get(key string) (value ByteView, ok bool) {
+	if v, ok := c.twoq.Get(key); ok {
+		return v.(ByteView), true
+	}
+	return
+}
+
+func (c *twoQueueCache) Add(key string, value ByteView, expire time.Time) {
+	c.twoq.AddWithExpire(key, value, expire)
+}
+
+func (c *twoQueueCache) Remove(key string) { c.twoq.Remove(key) }
+func (c *twoQueueCache) Len() int          { return c.twoq.Len() }
+func (c *twoQueueCache) Bytes() int64      { return c.twoq.Bytes() }
+func (c *twoQueueCache) Clear()            { c.twoq.Clear() }
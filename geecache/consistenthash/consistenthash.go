@@ -2,6 +2,7 @@ package consistenthash
 
 import (
 	"hash/crc32"
+	"math"
 	"sort"
 	"strconv"
 )
@@ -9,17 +10,23 @@ import (
 type Hash func(data []byte) uint32 //定义了函数类型 Hash，采取依赖注入的方式，允许用于替换成自定义的 Hash 函数，也方便测试时替换，默认为 crc32.ChecksumIEEE 算法。
 
 /*
-Map 是一致性哈希算法的主数据结构，包含 4 个成员变量：
+Map 是一致性哈希算法的主数据结构，包含 5 个成员变量：
 Hash 函数 hash；
 虚拟节点倍数 replicas；
-哈希环 keys；
+哈希环 keys，已排序且没有重复的哈希值；
 虚拟节点与真实节点的映射表 hashMap，键是虚拟节点的哈希值，值是真实节点的名称。
+不同虚拟节点的哈希值可能冲突，此时值中会有多个真实节点，按名称排序后由第一个节点拥有该虚拟节点，保证结果与添加顺序无关；
+真实节点与虚拟节点数量的映射表 nodes，用于删除节点和枚举当前节点；
+有界负载模式下的负载系数 loadFactor 和获取真实节点当前负载的函数 load，见 SetBoundedLoad。
 */
 type Map struct {
-	hash     Hash
-	replicas int
-	keys     []int
-	hashMap  map[int]string
+	hash       Hash
+	replicas   int
+	keys       []int
+	hashMap    map[int][]string
+	nodes      map[string]int
+	loadFactor float64
+	load       func(node string) int64
 }
 
 // New 函数通过传入的虚拟节点倍数replicas和哈希函数fn，返回一个名为Map的数据结构。
@@ -27,7 +34,8 @@ func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
+		hashMap:  make(map[int][]string),
+		nodes:    make(map[string]int),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE //使用默认的哈希算法crc32.ChecksumIEEE
@@ -38,19 +46,108 @@ func New(replicas int, fn Hash) *Map {
 /*
 Add 函数允许传入 0 或 多个真实节点的名称。
 对每一个真实节点 key，对应创建 m.replicas 个虚拟节点，虚拟节点的名称是：strconv.Itoa(i) + key，即通过添加编号的方式区分不同虚拟节点。
-使用 m.hash() 计算虚拟节点的哈希值，使用 append(m.keys, hash) 添加到环上。
+使用 m.hash() 计算虚拟节点的哈希值，新的哈希值使用 append(m.keys, hash) 添加到环上。
 在 hashMap 中增加虚拟节点和真实节点的映射关系。
 最后一步，环上的哈希值排序。
+已经存在的节点会被忽略。
 */
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		m.add(key, m.replicas)
+	}
+	sort.Ints(m.keys)
+}
+
+// AddWeighted 函数添加一个带权重的真实节点，虚拟节点数量为 m.replicas * weight，
+// 使节点分到的 key 的比例与权重成正比。weight 小于 1 时按 1 处理，已经存在的节点会被忽略。
+func (m *Map) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	m.add(key, m.replicas*weight)
+	sort.Ints(m.keys)
+}
+
+// add 函数为真实节点 key 创建 replicas 个虚拟节点，调用方负责对 m.keys 排序。
+func (m *Map) add(key string, replicas int) {
+	if _, ok := m.nodes[key]; ok {
+		return
+	}
+	m.nodes[key] = replicas
+	for i := 0; i < replicas; i++ {
+		hash := m.vnodeHash(key, i)
+		owners := m.hashMap[hash]
+		if len(owners) == 0 {
 			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
 		}
+		owners = append(owners, key)
+		sort.Strings(owners) //发生冲突时按名称排序，第一个节点拥有该虚拟节点
+		m.hashMap[hash] = owners
 	}
-	sort.Ints(m.keys)
+}
+
+// Remove 函数删除传入的真实节点及其所有虚拟节点，不存在的节点会被忽略。
+// 与被删除节点冲突的其他节点会重新拥有对应的虚拟节点。
+func (m *Map) Remove(keys ...string) {
+	removed := false
+	for _, key := range keys {
+		replicas, ok := m.nodes[key]
+		if !ok {
+			continue
+		}
+		delete(m.nodes, key)
+		for i := 0; i < replicas; i++ {
+			hash := m.vnodeHash(key, i)
+			owners := m.hashMap[hash]
+			for j, owner := range owners {
+				if owner == key { //每个虚拟节点只删除一次，同一节点的不同虚拟节点也可能冲突
+					owners = append(owners[:j], owners[j+1:]...)
+					break
+				}
+			}
+			if len(owners) == 0 {
+				delete(m.hashMap, hash)
+				removed = true
+			} else {
+				m.hashMap[hash] = owners
+			}
+		}
+	}
+	if !removed {
+		return
+	}
+	keys2 := m.keys[:0] //过滤掉已经没有真实节点的哈希值，剩下的哈希值仍然有序
+	for _, hash := range m.keys {
+		if _, ok := m.hashMap[hash]; ok {
+			keys2 = append(keys2, hash)
+		}
+	}
+	m.keys = keys2
+}
+
+// Members 函数返回当前所有真实节点的名称，按名称排序。
+func (m *Map) Members() []string {
+	members := make([]string, 0, len(m.nodes))
+	for key := range m.nodes {
+		members = append(members, key)
+	}
+	sort.Strings(members)
+	return members
+}
+
+/*
+SetBoundedLoad 函数开启有界负载的一致性哈希（Consistent Hashing with Bounded Loads）。
+load 返回真实节点当前的负载，例如正在处理的请求数量。每个节点的容量是 c 倍的平均负载（按虚拟节点数量加权），
+Get 时如果顺时针遇到的第一个节点已经达到容量，就继续跳到下一个虚拟节点，直到找到还有余量的节点，
+从而避免热点 key 集中的节点被压垮。c 越接近 1 负载越均衡，但 key 的拥有者变化得越频繁。
+c 小于 1 或者 load 为 nil 时关闭有界负载模式。GetN 和 Diff 不受影响，仍然按照没有负载时的环计算。
+*/
+func (m *Map) SetBoundedLoad(c float64, load func(node string) int64) {
+	if c < 1 || load == nil {
+		m.loadFactor, m.load = 0, nil
+		return
+	}
+	m.loadFactor, m.load = c, load
 }
 
 /*
@@ -59,14 +156,124 @@ Get 函数主要是通过key获取真实节点
 第二步，顺时针找到第一个匹配的虚拟节点的下标 idx，从 m.keys 中获取到对应的哈希值。
 如果 idx == len(m.keys)，说明应选择 m.keys[0]，因为 m.keys 是一个环状结构，所以用取余数的方式来处理这种情况。
 第三步，通过 hashMap 映射得到真实的节点。
+开启有界负载模式时，跳过已经达到容量的节点。
 */
 func (m *Map) Get(key string) string {
 	if len(m.keys) == 0 {
 		return ""
 	}
 	hash := int(m.hash([]byte(key)))
+	if m.load == nil {
+		return m.owner(hash)
+	}
+	return m.boundedOwner(hash)
+}
+
+// boundedOwner 函数返回哈希值 hash 在环上顺时针遇到的第一个负载未达到容量的真实节点。
+// 节点 node 的容量为 ceil(c * (总负载 + 1) * node 的虚拟节点数量 / 虚拟节点总数)，加 1 是把本次请求也计算在内，
+// 所有节点的容量之和不小于总负载 + 1，所以一定能找到还有余量的节点。
+func (m *Map) boundedOwner(hash int) string {
+	loads := make(map[string]int64, len(m.nodes))
+	var total int64
+	vnodes := 0
+	for node, replicas := range m.nodes {
+		loads[node] = m.load(node)
+		total += loads[node]
+		vnodes += replicas
+	}
 	idx := sort.Search(len(m.keys), func(i int) bool {
 		return m.keys[i] >= hash
 	})
-	return m.hashMap[m.keys[idx%len(m.keys)]]
+	for i := 0; i < len(m.keys); i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]][0]
+		capacity := math.Ceil(m.loadFactor * float64(total+1) * float64(m.nodes[node]) / float64(vnodes))
+		if float64(loads[node]+1) <= capacity {
+			return node
+		}
+	}
+	return m.hashMap[m.keys[idx%len(m.keys)]][0]
+}
+
+// GetN 函数返回 key 在环上顺时针遇到的前 n 个不同的真实节点，第一个与 Get 的结果相同，
+// 后面的节点可以作为副本或者在第一个节点不可用时接管该 key。节点数量不足 n 时返回所有节点。
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]][0]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// owner 函数返回哈希值 hash 在环上顺时针遇到的第一个虚拟节点所属的真实节点。
+func (m *Map) owner(hash int) string {
+	if len(m.keys) == 0 {
+		return ""
+	}
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	return m.hashMap[m.keys[idx%len(m.keys)]][0]
+}
+
+// vnodeHash 函数返回真实节点 key 的第 i 个虚拟节点的哈希值。
+func (m *Map) vnodeHash(key string, i int) int {
+	return int(m.hash([]byte(strconv.Itoa(i) + key)))
+}
+
+// Range 表示哈希值落在闭区间 [Start, End] 内的 key 的拥有者从 From 变为 To。
+type Range struct {
+	Start, End uint32
+	From, To   string
+}
+
+/*
+Diff 函数比较成员变化前后的两个哈希环，返回拥有者发生变化的哈希值区间，用于规划 key 的迁移。
+两个环上所有虚拟节点的哈希值把整个哈希空间切分成若干段，每一段内的 key 在两个环上的拥有者都是固定的，
+只需要比较每一段末尾的拥有者即可。相邻且变化相同的区间会被合并，结果按 Start 排序。
+两个环应当使用相同的哈希函数。
+*/
+func Diff(old, new *Map) []Range {
+	points := make([]int, 0, len(old.keys)+len(new.keys))
+	points = append(points, old.keys...)
+	points = append(points, new.keys...)
+	sort.Ints(points)
+
+	var ranges []Range
+	start := 0
+	add := func(end int) {
+		from, to := old.owner(end), new.owner(end)
+		if from != to {
+			if n := len(ranges); n > 0 && int(ranges[n-1].End)+1 == start && ranges[n-1].From == from && ranges[n-1].To == to {
+				ranges[n-1].End = uint32(end)
+			} else {
+				ranges = append(ranges, Range{Start: uint32(start), End: uint32(end), From: from, To: to})
+			}
+		}
+		start = end + 1
+	}
+	for i, p := range points {
+		if i > 0 && p == points[i-1] {
+			continue
+		}
+		add(p)
+	}
+	if start <= math.MaxUint32 { //最后一个虚拟节点之后的区间属于环上的第一个虚拟节点
+		add(math.MaxUint32)
+	}
+	return ranges
 }
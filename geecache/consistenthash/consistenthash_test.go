@@ -1,6 +1,10 @@
 package consistenthash
 
 import (
+	"hash/crc32"
+	"math"
+	"reflect"
+	"sort"
 	"strconv"
 	"testing"
 )
@@ -34,3 +38,181 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2", "8")
+	hash.Remove("8", "unknown")
+
+	testCases := map[string]string{
+		"2":  "2",
+		"11": "2",
+		"23": "4",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s,should have yielded %s", k, v)
+		}
+	}
+	if members := hash.Members(); !reflect.DeepEqual(members, []string{"2", "4", "6"}) {
+		t.Errorf("Members should be [2 4 6], but got %v", members)
+	}
+	if len(hash.keys) != 9 || len(hash.hashMap) != 9 {
+		t.Errorf("virtual nodes of 8 should be removed")
+	}
+}
+
+// 测试虚拟节点哈希冲突时，拥有者与添加顺序无关，删除节点后冲突的节点重新拥有该虚拟节点
+func TestCollision(t *testing.T) {
+	collide := func(key []byte) uint32 {
+		if string(key) == "112" { //节点 "12" 的第 1 个虚拟节点与节点 "2" 的第 11 个虚拟节点同名
+			return 100
+		}
+		return crc32.ChecksumIEEE(key)
+	}
+	a, b := New(12, collide), New(12, collide)
+	a.Add("12", "2")
+	b.Add("2")
+	b.Add("12")
+	if a.hashMap[100][0] != "12" || b.hashMap[100][0] != "12" {
+		t.Fatalf("owner of a collided hash should not depend on insertion order")
+	}
+	a.Remove("12")
+	if owners := a.hashMap[100]; !reflect.DeepEqual(owners, []string{"2"}) {
+		t.Fatalf("collided hash should be owned by 2 after removing 12, but got %v", owners)
+	}
+	if idx := sort.SearchInts(a.keys, 100); idx == len(a.keys) || a.keys[idx] != 100 {
+		t.Fatalf("collided hash should stay on the ring")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	hash := func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	}
+	old, new := New(3, hash), New(3, hash)
+	old.Add("6", "4", "2")
+	new.Add("6", "4", "2", "8")
+	// 8 的虚拟节点是 8, 18, 28，分别接管了 (6,8]、(16,18]、(26,28]，这些区间原本都属于节点 2 的虚拟节点 12、22、2
+	expect := []Range{
+		{Start: 7, End: 8, From: "2", To: "8"},
+		{Start: 17, End: 18, From: "2", To: "8"},
+		{Start: 27, End: 28, From: "2", To: "8"},
+	}
+	if ranges := Diff(old, new); !reflect.DeepEqual(ranges, expect) {
+		t.Fatalf("expect %v, but got %v", expect, ranges)
+	}
+	expect = []Range{
+		{Start: 7, End: 8, From: "8", To: "2"},
+		{Start: 17, End: 18, From: "8", To: "2"},
+		{Start: 27, End: 28, From: "8", To: "2"},
+	}
+	if ranges := Diff(new, old); !reflect.DeepEqual(ranges, expect) {
+		t.Fatalf("expect %v, but got %v", expect, ranges)
+	}
+	if ranges := Diff(old, old); len(ranges) != 0 {
+		t.Fatalf("same ring should have no diff, but got %v", ranges)
+	}
+}
+
+// 测试节点分到的 key 的比例与权重成正比
+func TestAddWeighted(t *testing.T) {
+	hash := New(50, nil)
+	weights := map[string]int{"4G": 1, "8G": 2, "32G": 8}
+	total := 0
+	for node, weight := range weights {
+		hash.AddWeighted(node, weight)
+		total += weight
+	}
+	counts := make(map[string]int)
+	const n = 100000
+	for i := 0; i < n; i++ {
+		counts[hash.Get("key"+strconv.Itoa(i))]++
+	}
+	for node, weight := range weights {
+		expect := float64(weight) / float64(total)
+		share := float64(counts[node]) / n
+		if math.Abs(share-expect) > 0.05 {
+			t.Errorf("node %s with weight %d should own %.2f of keys, but owns %.2f", node, weight, expect, share)
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2")
+
+	testCases := map[string][]string{
+		"2":  {"2", "4"},
+		"11": {"2", "4"},
+		"23": {"4", "6"},
+		"27": {"2", "4"},
+	}
+	for k, v := range testCases {
+		if nodes := hash.GetN(k, 2); !reflect.DeepEqual(nodes, v) {
+			t.Errorf("Asking for %s,should have yielded %v, but got %v", k, v, nodes)
+		}
+	}
+	if nodes := hash.GetN("23", 5); !reflect.DeepEqual(nodes, []string{"4", "6", "2"}) {
+		t.Errorf("GetN should return all nodes when n is too large, but got %v", nodes)
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2")
+	loads := map[string]int64{"2": 10, "4": 1, "6": 1}
+	hash.SetBoundedLoad(1.25, func(node string) int64 {
+		return loads[node]
+	})
+	// 11 原本属于节点 2 的虚拟节点 12，节点 2 已经超过容量 ceil(1.25*13/3)=6，跳到下一个虚拟节点 14
+	if node := hash.Get("11"); node != "4" {
+		t.Fatalf("Asking for 11 should skip overloaded 2 and yield 4, but got %s", node)
+	}
+	if node := hash.Get("23"); node != "4" {
+		t.Fatalf("Asking for 23 should yield 4, but got %s", node)
+	}
+	if nodes := hash.GetN("11", 1); !reflect.DeepEqual(nodes, []string{"2"}) {
+		t.Fatalf("GetN should ignore loads, but got %v", nodes)
+	}
+	hash.SetBoundedLoad(0, nil)
+	if node := hash.Get("11"); node != "2" {
+		t.Fatalf("Asking for 11 should yield 2 after disabling bounded load, but got %s", node)
+	}
+}
+
+// 把 key 逐个分配给节点，每个节点的负载不会超过 c 倍的平均负载
+func TestBoundedLoadDistribution(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a", "b", "c", "d", "e")
+	hash.AddWeighted("f", 2)
+	loads := make(map[string]int64)
+	const c = 1.25
+	hash.SetBoundedLoad(c, func(node string) int64 {
+		return loads[node]
+	})
+	const n = 7000
+	for i := 0; i < n; i++ {
+		loads[hash.Get("key"+strconv.Itoa(i))]++
+	}
+	for node, load := range loads {
+		weight := 1.0
+		if node == "f" {
+			weight = 2
+		}
+		if limit := math.Ceil(c * n * weight / 7); float64(load) > limit {
+			t.Errorf("%s owns %d keys, more than %v", node, load, limit)
+		}
+	}
+}
@@ -3,9 +3,12 @@ package geecache
 import (
 	pb "Geecache/geecache/geecachepb"
 	"Geecache/geecache/singleflight"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"math/rand"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -21,14 +24,74 @@ func (f GetterFunc) Get(key string) ([]byte, error) { //函数类型实现某一
 	return f(key)
 }
 
+// GetterCtx 是支持 context 的 Getter，数据源可以通过 ctx 感知调用方的超时与取消。
+type GetterCtx interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// GetterCtxFunc 同理于 GetterFunc，是 GetterCtx 的接口型函数。
+type GetterCtxFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f GetterCtxFunc) Get(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// ExpiringGetter 是可以为每个 key 指定过期时间的 GetterCtx，Group 发现数据源实现了该接口时调用 GetWithExpire。
+// expire 是缓存值的绝对过期时间，零值表示使用缓存组默认的过期时间；已经过期的值会被返回给调用方，但不会被缓存。
+// 拥有该 key 的节点会把过期时间随响应传给其他节点，hotCache 中的副本也在同一时间过期。
+type ExpiringGetter interface {
+	GetterCtx
+	GetWithExpire(ctx context.Context, key string) (value []byte, expire time.Time, err error)
+}
+
+// ExpiringGetterFunc 是 ExpiringGetter 的接口型函数。
+type ExpiringGetterFunc func(ctx context.Context, key string) ([]byte, time.Time, error)
+
+func (f ExpiringGetterFunc) GetWithExpire(ctx context.Context, key string) ([]byte, time.Time, error) {
+	return f(ctx, key)
+}
+
+func (f ExpiringGetterFunc) Get(ctx context.Context, key string) ([]byte, error) {
+	value, _, err := f(ctx, key)
+	return value, err
+}
+
+// getterAdapter 将不支持 context 的 Getter 适配为 GetterCtx，调用前先检查 ctx 是否已经结束。
+type getterAdapter struct {
+	Getter
+}
+
+func (a getterAdapter) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.Getter.Get(key)
+}
+
 type Group struct {
 	name      string               //缓存组的名称。
-	getter    Getter               //实现了 Getter 接口的对象（回调），从数据源用于获取缓存数据。
+	getter    GetterCtx            //实现了 GetterCtx 接口的对象（回调），从数据源用于获取缓存数据。
 	mainCache BaseCache            // 主缓存，是一个 BaseCache 接口的实例，用于存储本地节点作为主节点所拥有的数据。
 	hotCache  BaseCache            // hotCache 则是为了存储热门数据的缓存。
 	peers     PeerPicker           //实现了 PeerPicker 接口的对象，用于根据键选择相应的缓存节点
 	loader    *singleflight.Group  //确保相同的请求只被执行一次
 	keys      map[string]*KeyStats //根据键key获取对应key的统计信息
+	keysMu    sync.Mutex           //保护 keys
+	hotQPS    int64                //热点 key 阈值，每分钟从远程节点获取的次数达到该值时放入hotCache
+	replicas  int                  //从远程节点获取数据时最多尝试的节点数量，拥有者不可用时依次尝试后面的节点
+	negative  *negativeCache       //负缓存，记录数据源中不存在的 key
+	softTTL   AtomicInt            //软过期时间（纳秒），缓存值加载后超过该时间仍然返回旧值，同时在后台重新加载，为 0 时关闭
+	ttl       time.Duration        //默认的过期时间，数据源没有指定过期时间时使用
+	jitter    time.Duration        //默认过期时间的最大随机抖动，避免同一时间加载的大量 key 同时过期
+	refresh   AtomicInt            //提前刷新窗口（纳秒），缓存值在过期前的这段时间内被读取时在后台重新加载，为 0 时关闭
+	timeout   time.Duration        //一次共享加载（访问远程节点和数据源）的最长时间，调用方的截止时间更早时以调用方为准
+	reloading sync.Map             //正在后台重新加载的 key，保证同一个 key 同时只有一个后台任务
+	janitor   *janitor             //后台清理过期记录的协程，没有开启时为 nil
+	ctx       context.Context      //缓存组的生命周期，Close 时取消，后台任务都从它派生
+	cancel    context.CancelFunc   //取消 ctx
+	closeMu   sync.Mutex           //保护 closed，保证 Close 之后不再启动新的后台任务
+	closed    bool                 //缓存组是否已经关闭
+	tasks     sync.WaitGroup       //正在运行的后台重新加载任务
 } //负责与用户的交互，并且控制缓存值存储和获取的流程。
 
 type AtomicInt int64 // 封装一个原子类，用于进行原子操作，保证并发安全.
@@ -43,42 +106,125 @@ func (i *AtomicInt) Get() int64 {
 	return atomic.LoadInt64((*int64)(i))
 }
 
+// Set 方法用于原子地设置 AtomicInt 中的值
+func (i *AtomicInt) Set(n int64) {
+	atomic.StoreInt64((*int64)(i), n)
+}
+
 type KeyStats struct { //Key的统计信息
 	firstGetTime time.Time //第一次请求的时间
 	remoteCnt    AtomicInt //请求的次数（利用atomic包封装的原子类）
 }
 
+const (
+	defaultTTL          = 60 * time.Second //默认的过期时间
+	defaultJitter       = 60 * time.Second //默认过期时间的最大随机抖动
+	defaultPeerReplicas = 2                //默认在拥有者不可用时再尝试 1 个备选节点
+	defaultLoadTimeout  = 10 * time.Second //默认的加载超时时间
+)
+
 var (
-	maxMinuteRemoteQPS = 10                      //最大QPS
-	mu                 sync.RWMutex              //读写锁
-	groups             = make(map[string]*Group) //map,根据键缓存组的名字，获取对应的缓存组
+	mu     sync.RWMutex              //读写锁
+	groups = make(map[string]*Group) //map,根据键缓存组的名字，获取对应的缓存组
 )
 
-// NewGroup 函数传入name,acheBytes,CacheType,getter,获取缓存组Group
+// NewGroup 函数传入name,acheBytes,CacheType,getter,获取缓存组Group，配置错误时 panic。
+// 它等价于使用 WithCacheBytes(cacheBytes) 和 WithPolicy(CacheType) 调用 NewGroupWithOptions
 func NewGroup(name string, cacheBytes int64, CacheType string, getter Getter) *Group { //增加CacheType,用来选择具体缓存淘汰算法
 	if getter == nil {
 		panic("nil Getter")
 	}
-	mu.Lock()
-	defer mu.Unlock()
+	return NewGroupCtx(name, cacheBytes, CacheType, getterAdapter{getter})
+}
+
+// NewGroupCtx 同理于 NewGroup，数据源是支持 context 的 GetterCtx
+func NewGroupCtx(name string, cacheBytes int64, CacheType string, getter GetterCtx) *Group {
+	g, err := NewGroupWithOptions(name, getter, WithCacheBytes(cacheBytes), WithPolicy(CacheType))
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// NewGroupWithOptions 创建名为 name 的缓存组，opts 修改默认配置，配置不合法时返回错误。
+// 默认使用 lru 算法，mainCache 容量为 64MB，hotCache 容量为其 1/8，过期时间为 60s 加上最多 60s 的随机抖动。
+// 同名的缓存组会被替换，旧的缓存组会被关闭
+func NewGroupWithOptions(name string, getter GetterCtx, opts ...GroupOption) (*Group, error) {
+	if getter == nil {
+		return nil, fmt.Errorf("nil Getter")
+	}
+	o := groupOptions{
+		policy:       "lru",
+		cacheBytes:   defaultCacheBytes,
+		hotBytes:     -1,
+		ttl:          defaultTTL,
+		jitter:       defaultJitter,
+		hotThreshold: defaultHotKeyThreshold,
+		loadTimeout:  defaultLoadTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	if o.hotBytes < 0 {
+		o.hotBytes = o.cacheBytes / defaultHotCacheFraction
+	}
 	g := &Group{
-		name:   name,
-		getter: getter,
-		loader: &singleflight.Group{},
-		keys:   map[string]*KeyStats{},
-	}
-	switch CacheType { //根据淘汰算法，实例化mainCache,hotCache
-	case "lru":
-		g.mainCache = &LRUcache{cacheBytes: cacheBytes, ttl: time.Second * 60}
-		g.hotCache = &LRUcache{cacheBytes: cacheBytes / 8, ttl: time.Second * 60}
-	case "lfu":
-		g.mainCache = &LFUcache{cacheBytes: cacheBytes, ttl: time.Second * 60}
-		g.hotCache = &LFUcache{cacheBytes: cacheBytes / 8, ttl: time.Second * 60}
-	default:
-		panic("Please select the correct algorithm!")
+		name:     name,
+		getter:   getter,
+		loader:   &singleflight.Group{},
+		keys:     map[string]*KeyStats{},
+		hotQPS:   int64(o.hotThreshold),
+		replicas: defaultPeerReplicas,
+		ttl:      o.ttl,
+		jitter:   o.jitter,
+		negative: &negativeCache{maxKeys: defaultNegativeKeys},
+		timeout:  o.loadTimeout,
 	}
+	g.negative.setTTL(o.negativeTTL)
+	g.softTTL.Set(int64(o.softTTL))
+	g.refresh.Set(int64(o.refresh))
+	factory, _ := lookupPolicy(o.policy) //根据淘汰算法，实例化mainCache,hotCache
+	mainCache := newSyncCache(factory, o.cacheBytes, o.onEvicted)
+	hotCache := newSyncCache(factory, o.hotBytes, nil)
+	g.mainCache, g.hotCache = mainCache, hotCache
+	if o.janitor > 0 {
+		g.janitor = startJanitor(o.janitor, defaultJanitorBatch, mainCache, hotCache)
+	}
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+	mu.Lock()
+	old := groups[name]
 	groups[name] = g
-	return g
+	mu.Unlock()
+	if old != nil { //停止被替换的缓存组的后台任务，否则它的 janitor 和重新加载会一直运行
+		old.Close()
+	}
+	return g, nil
+}
+
+// Close 关闭缓存组：停止后台清理过期记录的协程，取消并等待正在进行的后台重新加载，然后从全局的缓存组中移除。
+// 关闭后缓存组仍然可以读写，只是不再启动新的后台任务。可以重复调用
+func (g *Group) Close() {
+	g.closeMu.Lock()
+	if g.closed {
+		g.closeMu.Unlock()
+		return
+	}
+	g.closed = true
+	g.closeMu.Unlock()
+
+	g.cancel()
+	if g.janitor != nil {
+		g.janitor.close()
+	}
+	g.tasks.Wait()
+	mu.Lock()
+	if groups[g.name] == g { //同名的缓存组可能已经被替换
+		delete(groups, g.name)
+	}
+	mu.Unlock()
 }
 
 // GetGroup 根据name获取对应的Group
@@ -91,58 +237,339 @@ func GetGroup(name string) *Group {
 
 // Get 函数用于获取缓存数据，获取顺序为：热点缓存、主缓存、数据源
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 同理于 Get，ctx 结束时立即返回 ctx.Err()。同一个 key 的加载由所有调用方共享，
+// 截止时间是这些调用方中最晚的截止时间，并且不超过 WithLoadTimeout 设置的超时；所有调用方都放弃时加载被取消
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
 	if v, ok := g.hotCache.get(key); ok {
 		log.Println("[GeeCache] hit hotCache")
+		g.maybeReload(key, v, true)
 		return v, nil
 	}
 	if v, ok := g.mainCache.get(key); ok {
 		log.Println("[GeeCache] hit mainCache")
+		g.maybeReload(key, v, false)
 		return v, nil
 	}
-	return g.load(key)
+	if g.negative.has(key) {
+		log.Println("[GeeCache] hit negative cache")
+		return ByteView{}, notFound(key)
+	}
+	return g.load(ctx, key)
+}
+
+// SetNegativeTTL 设置负缓存的过期时间，默认为 0，即不开启负缓存。
+// 开启后，数据源返回 ErrNotFound 的 key 在 ttl 内不会再次查询数据源，远程节点返回的不存在也会在本地缓存。
+// ttl 应当设置得较短，例如几秒，因为在其他节点直接写入数据源的新 key 要等负缓存过期后才能被读到。
+func (g *Group) SetNegativeTTL(ttl time.Duration) {
+	g.negative.setTTL(ttl)
+}
+
+// SetSoftTTL 设置软过期时间，默认为 0，即不开启。缓存值加载后超过 ttl 时仍然立即返回旧值，
+// 同时在后台通过 singleflight 重新加载一次（stale-while-revalidate），读者不必等待数据源。
+// ttl 应当小于缓存的过期时间，缓存值真正过期后仍然需要同步加载。可以在读写缓存组的同时调用，也可以通过 WithSoftTTL 设置
+func (g *Group) SetSoftTTL(ttl time.Duration) {
+	g.softTTL.Set(int64(ttl))
+}
+
+// SetRefreshAhead 设置提前刷新窗口，默认为 0，即不开启。缓存值在过期前 window 时间内被读取时，
+// 在后台重新加载，使经常被访问的 key 在过期之前就换上新值；窗口内没有被读取的冷 key 仍然正常过期。
+// 可以在读写缓存组的同时调用，也可以通过 WithRefreshAhead 设置
+func (g *Group) SetRefreshAhead(window time.Duration) {
+	g.refresh.Set(int64(window))
+}
+
+// maybeReload 判断缓存值是否超过软过期时间或者进入提前刷新窗口，是则在后台重新加载。hot 表示 v 来自 hotCache
+func (g *Group) maybeReload(key string, v ByteView, hot bool) {
+	now := time.Now()
+	softTTL, refresh := time.Duration(g.softTTL.Get()), time.Duration(g.refresh.Get())
+	stale := softTTL > 0 && !v.t.IsZero() && now.Sub(v.t) >= softTTL
+	expiring := refresh > 0 && !v.e.IsZero() && v.e.Sub(now) <= refresh
+	if stale || expiring {
+		g.reload(key, hot)
+	}
+}
+
+// reload 在后台重新加载 key，同一个 key 同时只有一个后台任务，并且与前台的加载共用 singleflight。
+// 从数据源加载的值由 getLocally 写入 mainCache，hot 为 true 时把新值写入 hotCache。
+// 缓存组关闭后不再启动新的后台任务。
+func (g *Group) reload(key string, hot bool) {
+	g.closeMu.Lock()
+	defer g.closeMu.Unlock()
+	if g.closed {
+		return
+	}
+	if _, loading := g.reloading.LoadOrStore(key, struct{}{}); loading {
+		return
+	}
+	g.tasks.Add(1)
+	go func() {
+		defer g.tasks.Done()
+		defer g.reloading.Delete(key)
+		view, err := g.load(g.ctx, key) //缓存组关闭时放弃等待，没有其他调用方等待时加载被取消
+		if err != nil {
+			log.Println("[GeeCache] Failed to reload", key, err)
+			return
+		}
+		if hot {
+			g.populateHotCache(key, view)
+		}
+	}()
+}
+
+// notFound 返回 key 不存在的错误，满足 errors.Is(err, ErrNotFound)
+func notFound(key string) error {
+	return fmt.Errorf("%s: %w", key, ErrNotFound)
+}
+
+// peerRequestKey 是 context 中标记请求来自远程节点的键
+type peerRequestKey struct{}
+
+// withPeerRequest 标记 ctx 对应的请求是远程节点转发过来的
+func withPeerRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, peerRequestKey{}, true)
+}
+
+// isPeerRequest 判断 ctx 对应的请求是否是远程节点转发过来的
+func isPeerRequest(ctx context.Context) bool {
+	fromPeer, _ := ctx.Value(peerRequestKey{}).(bool)
+	return fromPeer
+}
+
+// SetReplicas 设置从远程节点获取数据时最多尝试的节点数量，n 小于 1 时按 1 处理，即只尝试拥有者。
+// 拥有者不可用时，各节点会依次尝试相同的备选节点，由备选节点访问数据源，而不是每个节点都去访问数据源。
+func (g *Group) SetReplicas(n int) {
+	if n < 1 {
+		n = 1
+	}
+	g.replicas = n
 }
 
 // load 方法的逻辑是首先尝试从远程节点获取数据，如果失败或者没有配置远程节点，则回退到本地获取。
-func (g *Group) load(key string) (value ByteView, err error) {
-	view, err := g.loader.Do(key, func() (interface{}, error) { //singleFlight原理，相同请求只执行一次
-		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok { //根据key选择远程节点
-				if value, err = g.getFromPeer(peer, key); err == nil { //从远程节点获取数据
+// 拥有者获取失败时依次尝试备选节点，全部失败或者轮到当前节点时才从本地获取。
+// 远程节点转发过来的请求直接从本地获取，不再转发：各节点看到的集群成员和负载可能不一致，再次转发可能在节点之间来回传递。
+func (g *Group) load(ctx context.Context, key string) (ByteView, error) {
+	view, err := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) { //singleFlight原理，相同请求只执行一次
+		//ctx 的截止时间是所有等待者中最晚的截止时间，最后一个等待者放弃时被取消，g.timeout 是加载的最长时间
+		ctx, cancel := context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+		if g.peers != nil && !isPeerRequest(ctx) {
+			for _, peer := range g.peers.PickPeers(key, g.replicas) { //根据key按优先级选择远程节点
+				value, err := g.getFromPeer(ctx, peer, key) //从远程节点获取数据
+				if err == nil {
 					return value, nil
 				}
+				if errors.Is(err, ErrNotFound) { //远程节点确认 key 不存在，不必再尝试其他节点
+					return nil, err
+				}
 				log.Println("[GeeCache] Failed to get from peer", err)
+				if ctx.Err() != nil { //已经超时或者所有调用方都已经放弃，不必再尝试其他节点或回退到数据源
+					return nil, ctx.Err()
+				}
 			}
 		}
-		return g.getLocally(key) //从本地获取缓存数据
+		return g.getLocally(ctx, key) //从本地获取缓存数据
 	})
-	if err == nil {
-		return view.(ByteView), nil
+	if err != nil {
+		return ByteView{}, err
 	}
-	return
+	return view.(ByteView), nil
 }
 
-// getLocally 从数据源获取数据，然后将数据添加到mainCache中
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+// getLocally 从数据源获取数据，然后将数据添加到mainCache中。
+// 数据源实现了 ExpiringGetter 时使用它返回的过期时间，否则使用默认的过期时间。
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	var bytes []byte
+	var expire time.Time
+	var err error
+	if eg, ok := g.getter.(ExpiringGetter); ok {
+		bytes, expire, err = eg.GetWithExpire(ctx, key)
+	} else {
+		bytes, err = g.getter.Get(ctx, key)
+	}
 	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			g.negative.add(key)
+		}
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes)}
+	value := ByteView{b: cloneBytes(bytes), t: time.Now(), e: expire}
+	if value.e.IsZero() {
+		value.e = g.expireAt(0)
+	}
 	g.populateCache(key, value)
 	return value, nil
 }
 
-// populateCache 将数据添加到mainCache中
+// expireAt 返回 ttl 之后的过期时间，ttl 小于等于 0 时使用默认的过期时间并加上随机抖动
+func (g *Group) expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = g.ttl
+		if g.jitter > 0 {
+			ttl += time.Duration(rand.Int63n(int64(g.jitter)))
+		}
+	}
+	return time.Now().Add(ttl)
+}
+
+// populateCache 将数据添加到mainCache中，value.e 为零值时使用默认的过期时间，已经过期的数据不会被缓存
 func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+	if value.e.IsZero() {
+		value.e = g.expireAt(0)
+	}
+	if value.e.After(time.Now()) {
+		g.mainCache.add(key, value)
+	}
 }
 
-// populateHotCache 将数据添加到hotCache中
+// populateHotCache 将数据添加到hotCache中，过期时间与拥有该 key 的节点一致
 func (g *Group) populateHotCache(key string, value ByteView) {
-	g.hotCache.add(key, value)
+	if value.e.IsZero() {
+		value.e = g.expireAt(0)
+	}
+	if value.e.After(time.Now()) {
+		g.hotCache.add(key, value)
+	}
+}
+
+// ErrValueTooLarge 表示 Set 写入的缓存值超过了 maxInlineValue。写入请求需要放在一个 gRPC 消息中，
+// 更大的缓存值只能由数据源加载，读取时通过 GetStream 分块传输
+var ErrValueTooLarge = errors.New("value too large")
+
+// Set 等价于使用 context.Background() 的 SetContext
+func (g *Group) Set(key string, value []byte, ttl time.Duration) error {
+	return g.SetContext(context.Background(), key, value, ttl)
+}
+
+// SetContext 将缓存值写入拥有该 key 的节点，ttl 小于等于 0 时使用默认的过期时间。
+// 写入成功后会删除所有节点 hotCache 中的旧副本以及非拥有者 mainCache 中的副本。
+// 整个操作受 ctx 和 WithLoadTimeout 设置的超时限制，不会因为某个节点没有响应而一直阻塞。
+// 缓存值超过 maxInlineValue 时返回 ErrValueTooLarge，无论拥有者是不是当前节点。
+func (g *Group) SetContext(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if err := checkValueSize(key, value); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	if peer, ok := g.pickPeer(key); ok {
+		req := &pb.PutRequest{
+			Group: g.name,
+			Key:   key,
+			Value: value,
+			Ttl:   ttl.Milliseconds(),
+		}
+		if err := peer.Put(ctx, req); err != nil {
+			return err
+		}
+	} else {
+		g.setLocally(key, value, ttl)
+	}
+	return g.invalidate(ctx, key)
+}
+
+// checkValueSize 检查写入的缓存值是否能放在一个 gRPC 消息中
+func checkValueSize(key string, value []byte) error {
+	if len(value) > maxInlineValue {
+		return fmt.Errorf("%s: %w: %d bytes, at most %d", key, ErrValueTooLarge, len(value), maxInlineValue)
+	}
+	return nil
+}
+
+// Remove 等价于使用 context.Background() 的 RemoveContext
+func (g *Group) Remove(key string) error {
+	return g.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext 从拥有该 key 的节点删除缓存值，并删除所有节点 hotCache 中的副本以及非拥有者 mainCache 中的副本。
+// 与 SetContext 一样受 ctx 和 WithLoadTimeout 设置的超时限制。
+func (g *Group) RemoveContext(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	if peer, ok := g.pickPeer(key); ok {
+		if err := peer.Remove(ctx, &pb.Request{Group: g.name, Key: key}); err != nil {
+			return err
+		}
+	} else {
+		g.removeLocally(key)
+	}
+	return g.invalidate(ctx, key)
+}
+
+// Invalidate 等价于使用 context.Background() 的 InvalidateContext
+func (g *Group) Invalidate(key string) error {
+	return g.InvalidateContext(context.Background(), key)
+}
+
+// InvalidateContext 删除所有节点 hotCache 中的副本以及非拥有者 mainCache 中的副本，拥有该 key 的节点上的值保持不变，
+// 之后的请求会重新从拥有该 key 的节点获取。与 SetContext 一样受 ctx 和 WithLoadTimeout 设置的超时限制。
+func (g *Group) InvalidateContext(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	return g.invalidate(ctx, key)
+}
+
+// pickPeer 根据 key 选择远程节点，没有注册节点或者选中自己时返回 false
+func (g *Group) pickPeer(key string) (PeerGetter, bool) {
+	if g.peers == nil {
+		return nil, false
+	}
+	return g.peers.PickPeer(key)
+}
+
+// invalidate 删除本地以及所有远程节点的副本，返回第一个失败的错误
+func (g *Group) invalidate(ctx context.Context, key string) error {
+	g.invalidateLocally(key)
+	if g.peers == nil {
+		return nil
+	}
+	var firstErr error
+	for _, peer := range g.peers.AllPeers() {
+		if err := peer.Invalidate(ctx, &pb.Request{Group: g.name, Key: key}); err != nil {
+			log.Println("[GeeCache] Failed to invalidate peer", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// setLocally 将数据写入本地的mainCache，同时删除本地hotCache中的旧副本和负缓存记录
+func (g *Group) setLocally(key string, value []byte, ttl time.Duration) {
+	g.mainCache.add(key, ByteView{b: cloneBytes(value), t: time.Now(), e: g.expireAt(ttl)})
+	g.hotCache.remove(key)
+	g.negative.remove(key)
+}
+
+// removeLocally 从本地的mainCache、hotCache和负缓存中删除数据
+func (g *Group) removeLocally(key string) {
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+	g.negative.remove(key)
+}
+
+// invalidateLocally 从本地的hotCache和负缓存中删除数据。当前节点不是拥有者时还会删除mainCache中的副本，
+// 这些副本是拥有者不可用时由备选节点或者本地回退加载的，不删除会在 Remove 之后继续返回旧值
+func (g *Group) invalidateLocally(key string) {
+	g.hotCache.remove(key)
+	g.negative.remove(key)
+	if _, remote := g.pickPeer(key); remote {
+		g.mainCache.remove(key)
+	}
 }
 
 func (g *Group) RegisterPeers(peers PeerPicker) {
@@ -155,29 +582,42 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 //这样，在分布式缓存系统的运行过程中，当需要根据键选择远程节点时，可以通过调用 g.peers.PickPeer(key) 来获取合适的远程节点的 PeerGetter 对象。
 
 // getFromPeer 实现了 PeerGetter 接口的 Client 从访问远程节点，获取缓存值。
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
-	res := &pb.Response{}
-	err := peer.Get(req, res)
+	res := &pb.GetResponse{}
+	err := peer.Get(ctx, req, res)
 	if err != nil {
 		return ByteView{}, err
 	}
-	//远程获取cnt++
+	return g.peerView(key, res)
+}
+
+// peerView 把远程节点的响应转换为缓存值，key 不存在时记录到负缓存，并统计 key 的远程获取次数，达到热点阈值时放入 hotCache
+func (g *Group) peerView(key string, res *pb.GetResponse) (ByteView, error) {
+	if res.NotFound {
+		g.negative.add(key)
+		return ByteView{}, notFound(key)
+	}
+	view := ByteView{b: res.Value, t: time.Now()}
+	if res.Expire > 0 { //使用拥有者给出的过期时间，各节点的时钟偏差会使副本提前或推迟过期
+		view.e = time.UnixMilli(res.Expire)
+	}
+	//远程获取cnt++，不同 key 的加载可能并发进行，统计信息由 keysMu 保护
+	g.keysMu.Lock()
+	defer g.keysMu.Unlock()
 	if stat, ok := g.keys[key]; ok {
 		stat.remoteCnt.Add(1)
 		//计算QPS
 		interval := float64(time.Now().Unix()-stat.firstGetTime.Unix()) / 60
 		qps := stat.remoteCnt.Get() / int64(math.Max(1, math.Round(interval)))
-		if qps >= int64(maxMinuteRemoteQPS) {
+		if qps >= g.hotQPS {
 			//存入hotCache
-			g.populateHotCache(key, ByteView{b: res.Value})
+			g.populateHotCache(key, view)
 			//删除映射关系,节省内存
-			mu.Lock()
 			delete(g.keys, key)
-			mu.Unlock()
 		}
 	} else {
 		//第一次获取
@@ -186,5 +626,5 @@ func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 			remoteCnt:    1,
 		}
 	}
-	return ByteView{b: res.Value}, nil
+	return view, nil
 }
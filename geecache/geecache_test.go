@@ -1,10 +1,18 @@
 package geecache
 
 import (
+	pb "Geecache/geecache/geecachepb"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // 定义一个函数类型 F，并且实现接口 A 的方法，然后在这个方法中调用自己。这是 Go 语言中将其他函数（参数返回值定义与 F 一致）转换为接口 A 的常用技巧。
@@ -79,3 +87,1023 @@ func TestGet2(t *testing.T) {
 		t.Fatalf("the value of unknow should be empty,but %s got", view)
 	}
 }
+
+// 测试 GetContext 会把 ctx 传递给数据源，并在 ctx 结束后返回错误
+func TestGetContext(t *testing.T) {
+	gee := NewGroupCtx("ctx-scores", 2<<10, "lru", GetterCtxFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Second):
+				return []byte(db[key]), nil
+			}
+		}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := gee.GetContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect %v, but got %v", context.DeadlineExceeded, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	legacy := NewGroup("ctx-legacy", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("getter should not be called after ctx is canceled")
+			return nil, nil
+		}))
+	if _, err := legacy.GetContext(ctx, "Tom"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect %v, but got %v", context.Canceled, err)
+	}
+}
+
+// 测试发起加载的调用方取消后，等待同一个 key 的其他调用方仍然拿到结果，数据源看到的 ctx 没有被取消
+func TestGetContextShared(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var loads AtomicInt
+	gee, _ := NewGroupWithOptions("shared-scores", GetterCtxFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			loads.Add(1)
+			close(started)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-release:
+				return []byte(db[key]), nil
+			}
+		}), WithLoadTimeout(time.Second))
+	defer gee.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := gee.GetContext(ctx, "Tom")
+		canceled <- err
+	}()
+	<-started
+	live := make(chan error, 1)
+	var view ByteView
+	go func() {
+		var err error
+		view, err = gee.GetContext(context.Background(), "Tom")
+		live <- err
+	}()
+	time.Sleep(10 * time.Millisecond) //等待第二个调用方加入同一次加载
+	cancel()
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled caller should return %v, but got %v", context.Canceled, err)
+	}
+	close(release)
+	if err := <-live; err != nil || view.String() != "630" || loads.Get() != 1 {
+		t.Fatalf("live caller should get Tom=630 from one load, but got %s, %v, %d loads", view, err, loads.Get())
+	}
+}
+
+// 调用方的截止时间早于加载的超时时间时，数据源看到调用方的截止时间，调用方放弃后加载被取消
+func TestGetContextDeadline(t *testing.T) {
+	deadlines, canceled := make(chan time.Time, 1), make(chan error, 1)
+	gee, _ := NewGroupWithOptions("deadline-scores", GetterCtxFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			deadline, _ := ctx.Deadline()
+			deadlines <- deadline
+			<-ctx.Done()
+			canceled <- ctx.Err()
+			return nil, ctx.Err()
+		}), WithLoadTimeout(time.Minute))
+	defer gee.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := gee.GetContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect %v, but got %v", context.DeadlineExceeded, err)
+	}
+	if deadline, _ := ctx.Deadline(); !(<-deadlines).Equal(deadline) {
+		t.Fatalf("getter should see the deadline of the caller")
+	}
+	select {
+	case err := <-canceled:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("getter ctx should expire with the caller, but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("getter should be cancelled when the only caller leaves")
+	}
+}
+
+// fakePeer 是测试用的远程节点，记录收到的请求
+type fakePeer struct {
+	values      map[string][]byte
+	invalidated []string
+	notFound    bool  //为 true 时像 Server 一样通过 NotFound 字段返回不存在的 key，否则返回错误
+	expire      int64 //随响应返回的过期时间
+	gets        AtomicInt
+}
+
+func (p *fakePeer) Get(ctx context.Context, in *pb.Request, out *pb.GetResponse) error {
+	p.gets.Add(1)
+	v, ok := p.values[in.Key]
+	if !ok && p.notFound {
+		out.NotFound = true
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("%s not exist", in.Key)
+	}
+	out.Value = v
+	out.Expire = p.expire
+	return nil
+}
+
+func (p *fakePeer) Put(ctx context.Context, in *pb.PutRequest) error {
+	p.values[in.Key] = in.Value
+	return nil
+}
+
+func (p *fakePeer) Remove(ctx context.Context, in *pb.Request) error {
+	delete(p.values, in.Key)
+	return nil
+}
+
+func (p *fakePeer) Invalidate(ctx context.Context, in *pb.Request) error {
+	p.invalidated = append(p.invalidated, in.Key)
+	return nil
+}
+
+// fakePicker 将 owners 中的 key 交给 owner 处理，其余 key 由本地处理
+type fakePicker struct {
+	owner  *fakePeer
+	others []*fakePeer
+	owns   map[string]bool
+}
+
+func (p *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	if p.owns[key] {
+		return p.owner, true
+	}
+	return nil, false
+}
+
+func (p *fakePicker) PickPeers(key string, n int) []PeerGetter {
+	if !p.owns[key] {
+		return nil
+	}
+	peers := p.AllPeers()
+	if len(peers) > n {
+		peers = peers[:n]
+	}
+	return peers
+}
+
+func (p *fakePicker) AllPeers() []PeerGetter {
+	peers := []PeerGetter{p.owner}
+	for _, peer := range p.others {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// 测试 Set、Remove、Invalidate 的路由与广播
+func TestSetRemoveInvalidate(t *testing.T) {
+	gee := NewGroup("set-scores", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	picker := &fakePicker{
+		owner:  &fakePeer{values: map[string][]byte{}},
+		others: []*fakePeer{{values: map[string][]byte{}}},
+		owns:   map[string]bool{"remote": true},
+	}
+	gee.RegisterPeers(picker)
+
+	if err := gee.Set("local", []byte("1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := gee.Get("local"); err != nil || view.String() != "1" {
+		t.Fatalf("expect local=1, but got %s, %v", view, err)
+	}
+	if err := gee.Set("remote", []byte("2"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if string(picker.owner.values["remote"]) != "2" {
+		t.Fatalf("Set should be routed to the owner")
+	}
+	gee.populateHotCache("remote", ByteView{b: []byte("2")})
+	gee.populateCache("remote", ByteView{b: []byte("2")}) //拥有者不可用时回退到本地加载的副本
+	if err := gee.Remove("remote"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := picker.owner.values["remote"]; ok {
+		t.Fatalf("Remove should be routed to the owner")
+	}
+	if _, ok := gee.hotCache.get("remote"); ok {
+		t.Fatalf("Remove should drop the local hotCache copy")
+	}
+	if _, ok := gee.mainCache.get("remote"); ok {
+		t.Fatalf("Remove should drop the mainCache copy on a node that does not own the key")
+	}
+	gee.invalidateLocally("local") //拥有者收到失效通知时保留自己的值
+	if _, ok := gee.mainCache.get("local"); !ok {
+		t.Fatalf("Invalidate should keep the value on the owner")
+	}
+	if err := gee.Remove("local"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gee.Get("local"); err == nil {
+		t.Fatalf("local should be removed")
+	}
+	if err := gee.Invalidate("remote"); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"local", "remote", "remote", "local", "remote"}
+	for _, peer := range append(picker.others, picker.owner) {
+		if !reflect.DeepEqual(peer.invalidated, expect) {
+			t.Fatalf("expect invalidated %v, but got %v", expect, peer.invalidated)
+		}
+	}
+}
+
+// hangingPeer 是不响应写入和删除请求的远程节点，直到 ctx 结束
+type hangingPeer struct {
+	*fakePeer
+}
+
+func (p hangingPeer) Put(ctx context.Context, in *pb.PutRequest) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (p hangingPeer) Remove(ctx context.Context, in *pb.Request) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// 拥有者没有响应时，Set 和 Remove 受 ctx 和加载超时的限制，不会一直阻塞
+func TestSetRemoveTimeout(t *testing.T) {
+	gee, _ := NewGroupWithOptions("hanging-scores", GetterCtxFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			return nil, notFound(key)
+		}), WithLoadTimeout(50*time.Millisecond))
+	defer gee.Close()
+	gee.RegisterPeers(&mapPicker{owners: map[string]PeerGetter{"Tom": hangingPeer{&fakePeer{values: map[string][]byte{}}}}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := gee.SetContext(ctx, "Tom", []byte("630"), 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect %v, but got %v", context.DeadlineExceeded, err)
+	}
+	start := time.Now()
+	if err := gee.Remove("Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect %v, but got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Remove should give up after the load timeout, but took %v", elapsed)
+	}
+}
+
+// 远程节点转发过来的请求由本地处理，不会再次转发
+func TestPeerRequestNotForwarded(t *testing.T) {
+	gee := NewGroup("forward-scores", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local"), nil
+		}))
+	gee.RegisterPeers(&fakePicker{
+		owner: &fakePeer{values: map[string][]byte{"Tom": []byte("remote")}},
+		owns:  map[string]bool{"Tom": true},
+	})
+	if view, err := gee.GetContext(withPeerRequest(context.Background()), "Tom"); err != nil || view.String() != "local" {
+		t.Fatalf("expect Tom=local, but got %s, %v", view, err)
+	}
+}
+
+// 拥有者获取失败时尝试备选节点，而不是直接访问数据源
+func TestLoadFailover(t *testing.T) {
+	loads := 0
+	gee := NewGroup("failover-scores", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("local"), nil
+		}))
+	gee.RegisterPeers(&fakePicker{
+		owner:  &fakePeer{values: map[string][]byte{}}, //拥有者不可用
+		others: []*fakePeer{{values: map[string][]byte{"Tom": []byte("replica")}}},
+		owns:   map[string]bool{"Tom": true, "Jack": true},
+	})
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "replica" || loads != 0 {
+		t.Fatalf("expect Tom=replica without loading locally, but got %s, %v, %d loads", view, err, loads)
+	}
+	gee.SetReplicas(1)
+	if view, err := gee.Get("Jack"); err != nil || view.String() != "local" || loads != 1 {
+		t.Fatalf("expect Jack=local after the owner failed, but got %s, %v, %d loads", view, err, loads)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	loads := 0
+	gee := NewGroup("negative-scores", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}))
+	for i := 0; i < 2; i++ {
+		if _, err := gee.Get("Tom"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect %v, but got %v", ErrNotFound, err)
+		}
+	}
+	if loads != 2 {
+		t.Fatalf("negative cache should be disabled by default, but loaded %d times", loads)
+	}
+
+	gee.SetNegativeTTL(50 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, err := gee.Get("Tom"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect %v, but got %v", ErrNotFound, err)
+		}
+	}
+	if loads != 3 {
+		t.Fatalf("missing key should be loaded once in ttl, but loaded %d times", loads-2)
+	}
+	time.Sleep(100 * time.Millisecond)
+	gee.Get("Tom")
+	if loads != 4 {
+		t.Fatalf("missing key should be loaded again after ttl")
+	}
+	if err := gee.Set("Tom", []byte("630"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("Set should clear negative cache, but got %s, %v", view, err)
+	}
+}
+
+// 远程节点返回不存在时不尝试备选节点和数据源，并在本地缓存该结果
+func TestPeerNotFound(t *testing.T) {
+	loads := 0
+	gee := NewGroup("peer-negative-scores", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("local"), nil
+		}))
+	gee.SetNegativeTTL(time.Minute)
+	picker := &fakePicker{
+		owner:  &fakePeer{values: map[string][]byte{}, notFound: true},
+		others: []*fakePeer{{values: map[string][]byte{"Tom": []byte("replica")}}},
+		owns:   map[string]bool{"Tom": true},
+	}
+	gee.RegisterPeers(picker)
+	for i := 0; i < 2; i++ {
+		if _, err := gee.Get("Tom"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect %v, but got %v", ErrNotFound, err)
+		}
+	}
+	if loads != 0 || picker.owner.gets.Get() != 1 || picker.others[0].gets.Get() != 0 {
+		t.Fatalf("not found should be cached without failover, got %d loads, %d owner gets, %d replica gets",
+			loads, picker.owner.gets.Get(), picker.others[0].gets.Get())
+	}
+	if err := gee.Invalidate("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gee.Get("Tom"); !errors.Is(err, ErrNotFound) || picker.owner.gets.Get() != 2 {
+		t.Fatalf("Invalidate should clear negative cache")
+	}
+}
+
+func TestNegativeCacheLimit(t *testing.T) {
+	c := &negativeCache{maxKeys: 10}
+	c.setTTL(time.Minute)
+	for i := 0; i < 100; i++ {
+		c.add(strconv.Itoa(i))
+	}
+	if len(c.keys) != 10 || !c.has("99") {
+		t.Fatalf("negative cache should keep at most 10 keys including the latest one, but got %d", len(c.keys))
+	}
+	c.setTTL(0)
+	if c.add("100"); c.has("100") {
+		t.Fatalf("disabled negative cache should not record keys")
+	}
+}
+
+// waitValue 等待 key 的值变为 expect，后台重新加载是异步的
+func waitValue(t *testing.T, g *Group, key, expect string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if view, err := g.Get(key); err == nil && view.String() == expect {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s should be reloaded to %s", key, expect)
+}
+
+func TestSoftTTL(t *testing.T) {
+	var loads AtomicInt
+	release := make(chan struct{})
+	gee := NewGroup("soft-scores", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			if n := loads.Get(); n > 0 {
+				<-release //后台重新加载时阻塞，检查读者不会等待
+			}
+			loads.Add(1)
+			return []byte(strconv.Itoa(int(loads.Get()))), nil
+		}))
+	gee.SetSoftTTL(20 * time.Millisecond)
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "1" {
+		t.Fatalf("expect Tom=1, but got %s, %v", view, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		if view, err := gee.Get("Tom"); err != nil || view.String() != "1" {
+			t.Fatalf("stale value should be returned while reloading, but got %s, %v", view, err)
+		}
+	}
+	close(release)
+	waitValue(t, gee, "Tom", "2")
+	if loads.Get() != 2 {
+		t.Fatalf("stale key should be reloaded once, but loaded %d times", loads.Get())
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	gee := NewGroup("refresh-scores", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("new"), nil
+		}))
+	if err := gee.Set("Tom", []byte("old"), 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	gee.SetRefreshAhead(5 * time.Second)
+	gee.Get("Tom")
+	if _, loading := gee.reloading.Load("Tom"); loading {
+		t.Fatalf("key outside the refresh window should not be reloaded")
+	}
+	gee.SetRefreshAhead(30 * time.Second)
+	if view, _ := gee.Get("Tom"); view.String() != "old" {
+		t.Fatalf("expiring value should be returned while reloading")
+	}
+	waitValue(t, gee, "Tom", "new")
+
+	done := make(chan struct{}) //读写缓存组的同时修改配置，由 -race 检查
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			gee.SetSoftTTL(time.Duration(i) * time.Millisecond)
+			gee.SetRefreshAhead(time.Duration(i) * time.Millisecond)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		gee.Get("Tom")
+	}
+	<-done
+}
+
+func TestExpiringGetter(t *testing.T) {
+	loads := 0
+	expire := time.Now().Add(50 * time.Millisecond)
+	gee := NewGroupCtx("expire-scores", 2<<10, "lru", ExpiringGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			loads++
+			if key == "expired" {
+				return []byte("old"), time.Now().Add(-time.Second), nil
+			}
+			return []byte("630"), expire, nil
+		}))
+	view, err := gee.Get("Tom")
+	if err != nil || view.String() != "630" || !view.e.Equal(expire) {
+		t.Fatalf("expect Tom=630 expiring at %v, but got %s at %v, %v", expire, view, view.e, err)
+	}
+	gee.Get("Tom")
+	if loads != 1 {
+		t.Fatalf("Tom should be cached before it expires")
+	}
+	time.Sleep(60 * time.Millisecond)
+	gee.Get("Tom")
+	if loads != 2 {
+		t.Fatalf("Tom should be loaded again after the expire time given by getter")
+	}
+	gee.Get("expired")
+	gee.Get("expired")
+	if loads != 4 {
+		t.Fatalf("expired value should not be cached")
+	}
+}
+
+// 远程节点返回的过期时间被 hotCache 使用
+func TestPeerExpire(t *testing.T) {
+	gee := NewGroup("peer-expire-scores", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	expire := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	peer := &fakePeer{values: map[string][]byte{"Tom": []byte("630")}, expire: expire.UnixMilli()}
+	view, err := gee.getFromPeer(context.Background(), peer, "Tom")
+	if err != nil || !view.e.Equal(expire) {
+		t.Fatalf("expect expire at %v, but got %v, %v", expire, view.e, err)
+	}
+	gee.populateHotCache("Tom", view)
+	if v, ok := gee.hotCache.get("Tom"); !ok || !v.e.Equal(expire) {
+		t.Fatalf("hotCache should keep the expire time of the owner")
+	}
+}
+
+func TestNewGroupWithOptions(t *testing.T) {
+	getter := GetterCtxFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	invalid := [][]GroupOption{
+		{WithPolicy("fifo")},
+		{WithCacheBytes(-1)},
+		{WithTTL(0)},
+		{WithJitter(-time.Second)},
+		{WithHotKeyThreshold(0)},
+		{WithNegativeCache(-time.Second)},
+		{WithLoadTimeout(0)},
+		{WithSoftTTL(-time.Second)},
+		{WithRefreshAhead(-time.Second)},
+	}
+	for _, opts := range invalid {
+		if _, err := NewGroupWithOptions("option-scores", getter, opts...); err == nil {
+			t.Fatalf("invalid options should return error")
+		}
+	}
+	if _, err := NewGroupWithOptions("option-scores", nil); err == nil {
+		t.Fatalf("nil getter should return error")
+	}
+
+	var evicted []string
+	gee, err := NewGroupWithOptions("option-scores", getter,
+		WithPolicy("lfu"),
+		WithCacheBytes(6),
+		WithHotCacheBytes(4),
+		WithTTL(time.Minute),
+		WithJitter(0),
+		WithHotKeyThreshold(3),
+		WithNegativeCache(time.Second),
+		WithLoadTimeout(time.Second),
+		WithSoftTTL(time.Hour),
+		WithRefreshAhead(time.Second),
+		WithOnEvicted(func(key string, value ByteView) {
+			evicted = append(evicted, key+"="+value.String())
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if GetGroup("option-scores") != gee {
+		t.Fatalf("group should be registered")
+	}
+	main, hot := gee.mainCache.(*syncCache), gee.hotCache.(*syncCache)
+	if main.maxBytes != 6 || hot.maxBytes != 4 || gee.ttl != time.Minute || gee.jitter != 0 || gee.hotQPS != 3 || gee.negative.ttl != time.Second || gee.timeout != time.Second ||
+		gee.softTTL.Get() != int64(time.Hour) || gee.refresh.Get() != int64(time.Second) {
+		t.Fatalf("options should be applied")
+	}
+	gee.Get("ab")
+	gee.Get("cd") //容量为 6，ab 被淘汰
+	if !reflect.DeepEqual(evicted, []string{"ab=ab"}) {
+		t.Fatalf("expect evicted [ab=ab], but got %v", evicted)
+	}
+	if view, _ := gee.Get("ab"); view.e.Sub(view.t) > time.Minute+time.Second {
+		t.Fatalf("expire time should not be jittered")
+	}
+}
+
+// countingCache 是测试用的第三方淘汰算法，在 lru 的基础上统计写入次数
+type countingCache struct {
+	Cache
+	adds *int
+}
+
+func (c countingCache) Add(key string, value ByteView, expire time.Time) {
+	*c.adds++
+	c.Cache.Add(key, value, expire)
+}
+
+func TestRegisterPolicy(t *testing.T) {
+	adds := 0
+	RegisterPolicy("counting", func(maxBytes int64, onEvicted func(string, ByteView)) Cache {
+		return countingCache{Cache: newLRUCache(maxBytes, onEvicted), adds: &adds}
+	})
+	policies := Policies()
+	if idx := sort.SearchStrings(policies, "counting"); !sort.StringsAreSorted(policies) || idx == len(policies) || policies[idx] != "counting" {
+		t.Fatalf("counting should be in policies %v", policies)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("registering a policy twice should panic")
+			}
+		}()
+		RegisterPolicy("lru", newLRUCache)
+	}()
+
+	gee := NewGroup("counting-scores", 2<<10, "counting", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	gee.Get("Tom")
+	gee.Get("Tom")
+	gee.populateHotCache("Jack", ByteView{b: []byte("589")})
+	if adds != 2 {
+		t.Fatalf("both mainCache and hotCache should use the registered policy, but got %d adds", adds)
+	}
+}
+
+// 淘汰算法的 Get 会修改内部状态，并发读写需要互斥，使用 -race 运行
+func TestCacheConcurrentGet(t *testing.T) {
+	for _, policy := range []string{"lru", "lfu", "tinylfu", "arc", "2q"} {
+		gee := NewGroup("concurrent-"+policy, 2<<10, policy, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte(key), nil
+			}))
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					gee.mainCache.get(strconv.Itoa(j % 10))
+					gee.populateCache(strconv.Itoa((i+j)%10), ByteView{b: []byte("v")})
+				}
+			}(i)
+		}
+		wg.Wait()
+	}
+}
+
+// 开启 janitor 后，不再被读取的过期记录也会被清理
+func TestJanitor(t *testing.T) {
+	var evicted AtomicInt
+	gee, err := NewGroupWithOptions("janitor-scores", GetterCtxFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			return []byte(key), nil
+		}),
+		WithTTL(20*time.Millisecond),
+		WithJitter(0),
+		WithJanitor(5*time.Millisecond),
+		WithOnEvicted(func(key string, value ByteView) {
+			evicted.Add(1)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gee.Close()
+	for i := 0; i < 10; i++ {
+		gee.Get("key" + strconv.Itoa(i))
+	}
+	for i := 0; i < 100 && evicted.Get() < 10; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if evicted.Get() != 10 {
+		t.Fatalf("expired keys should be removed by janitor, but removed %d", evicted.Get())
+	}
+	if _, err := NewGroupWithOptions("janitor-scores", GetterCtxFunc(nil), WithJanitor(-time.Second)); err == nil {
+		t.Fatalf("negative janitor interval should be rejected")
+	}
+}
+
+// Close 停止 janitor 和后台重新加载，之后不再启动新的后台任务
+func TestGroupClose(t *testing.T) {
+	var loads AtomicInt
+	release := make(chan struct{})
+	gee, err := NewGroupWithOptions("close-scores", GetterCtxFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			if loads.Get() > 0 {
+				select { //后台重新加载时阻塞，直到被 Close 取消
+				case <-release:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			loads.Add(1)
+			return []byte(key), nil
+		}),
+		WithJanitor(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gee.SetSoftTTL(time.Nanosecond)
+	gee.Get("Tom")
+	gee.Get("Tom") //触发后台重新加载
+	if _, loading := gee.reloading.Load("Tom"); !loading {
+		t.Fatalf("stale key should be reloading")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		gee.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		close(release)
+		t.Fatalf("Close should cancel the reload")
+	}
+	select {
+	case <-gee.janitor.done:
+	default:
+		t.Fatalf("janitor should stop after Close")
+	}
+	if GetGroup("close-scores") != nil {
+		t.Fatalf("closed group should be removed")
+	}
+	gee.Get("Tom")
+	if _, loading := gee.reloading.Load("Tom"); loading {
+		t.Fatalf("closed group should not start new reloads")
+	}
+	gee.Close()
+}
+
+// 同名的缓存组被替换时，旧的缓存组被关闭，新的缓存组不受影响
+func TestGroupReplace(t *testing.T) {
+	getter := GetterCtxFunc(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	old, err := NewGroupWithOptions("replace-scores", getter, WithJanitor(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gee, err := NewGroupWithOptions("replace-scores", getter, WithJanitor(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gee.Close()
+	select {
+	case <-old.janitor.done:
+	default:
+		t.Fatalf("janitor of the replaced group should stop")
+	}
+	if old.ctx.Err() == nil {
+		t.Fatalf("replaced group should be closed")
+	}
+	if GetGroup("replace-scores") != gee || gee.ctx.Err() != nil {
+		t.Fatalf("new group should stay registered and open")
+	}
+}
+
+// batchGetter 是测试用的 BatchGetter，记录每次批量查询的 key
+type batchGetter struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (g *batchGetter) Get(ctx context.Context, key string) ([]byte, error) {
+	values, err := g.GetBatch(ctx, []string{key})
+	if v, ok := values[key]; ok {
+		return v, err
+	}
+	return nil, notFound(key)
+}
+
+func (g *batchGetter) GetBatch(ctx context.Context, keys []string) (map[string][]byte, error) {
+	g.mu.Lock()
+	g.batches = append(g.batches, append([]string(nil), keys...))
+	g.mu.Unlock()
+	values := make(map[string][]byte)
+	for _, key := range keys {
+		if v, ok := db[key]; ok {
+			values[key] = []byte(v)
+		}
+	}
+	return values, nil
+}
+
+func TestGetMulti(t *testing.T) {
+	getter := &batchGetter{}
+	gee, err := NewGroupWithOptions("multi-scores", getter, WithNegativeCache(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gee.Get("Tom")
+	values, err := gee.GetMulti(context.Background(), []string{"Tom", "Jack", "Sam", "unknown", "Jack"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 3 || values["Tom"].String() != "630" || values["Jack"].String() != "589" || values["Sam"].String() != "567" {
+		t.Fatalf("unexpected values %v", values)
+	}
+	expect := [][]string{{"Tom"}, {"Jack", "Sam", "unknown"}}
+	if !reflect.DeepEqual(expect, getter.batches) {
+		t.Fatalf("expect batches %v, but got %v", expect, getter.batches)
+	}
+	gee.GetMulti(context.Background(), []string{"Jack", "unknown"}) //命中缓存和负缓存
+	if len(getter.batches) != 2 {
+		t.Fatalf("cached keys should not be loaded again, but got %v", getter.batches)
+	}
+
+	failing := NewGroup("multi-failing-scores", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "bad" {
+				return nil, fmt.Errorf("db error")
+			}
+			return []byte(db[key]), nil
+		}))
+	values, err = failing.GetMulti(context.Background(), []string{"Tom", "bad", ""})
+	if err == nil || len(values) != 1 || values["Tom"].String() != "630" {
+		t.Fatalf("partial results and an error should be returned, but got %v, %v", values, err)
+	}
+}
+
+// GetMulti 从数据源加载的 key 与同时到来的 Get 共享加载，同时加载的 key 不超过 maxConcurrentLoads 个
+func TestGetMultiShared(t *testing.T) {
+	var mu sync.Mutex
+	loads := make(map[string]int)
+	running, maxRunning := 0, 0
+	release := make(chan struct{})
+	gee := NewGroup("multi-shared-scores", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			loads[key]++
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			<-release
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return []byte(key), nil
+		}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gee.Get("key-0")
+	}()
+	time.Sleep(10 * time.Millisecond) //等待 Get 开始加载
+	keys := make([]string, 3*maxConcurrentLoads)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	result := make(chan map[string]ByteView, 1)
+	go func() {
+		values, _ := gee.GetMulti(context.Background(), keys)
+		result <- values
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	values := <-result
+	<-done
+	if len(values) != len(keys) {
+		t.Fatalf("expect %d values, but got %d", len(keys), len(values))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if loads["key-0"] != 1 {
+		t.Fatalf("key-0 should be loaded once, but got %d", loads["key-0"])
+	}
+	if maxRunning > maxConcurrentLoads+1 { //加上 Get 的一次加载
+		t.Fatalf("at most %d keys should be loaded at the same time, but got %d", maxConcurrentLoads, maxRunning)
+	}
+}
+
+// expiringBatchGetter 同时实现了 BatchGetter 和 ExpiringGetter
+type expiringBatchGetter struct {
+	batchGetter
+	expire time.Time
+}
+
+func (g *expiringBatchGetter) GetWithExpire(ctx context.Context, key string) ([]byte, time.Time, error) {
+	v, err := g.Get(ctx, key)
+	return v, g.expire, err
+}
+
+// 数据源同时实现了 ExpiringGetter 时，GetMulti 使用每个 key 自己的过期时间
+func TestGetMultiExpiring(t *testing.T) {
+	getter := &expiringBatchGetter{expire: time.Now().Add(time.Minute).Truncate(time.Millisecond)}
+	gee, err := NewGroupWithOptions("multi-expiring-scores", getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := gee.GetMulti(context.Background(), []string{"Tom", "Jack"})
+	if err != nil || len(values) != 2 {
+		t.Fatalf("unexpected values %v, %v", values, err)
+	}
+	for key, v := range values {
+		if !v.e.Equal(getter.expire) {
+			t.Fatalf("expect %s to expire at %v, but got %v", key, getter.expire, v.e)
+		}
+	}
+}
+
+// fakeBatchPeer 是支持 GetBatch 的 fakePeer
+type fakeBatchPeer struct {
+	*fakePeer
+	batches [][]string
+}
+
+func (p *fakeBatchPeer) GetBatch(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	p.batches = append(p.batches, in.Keys)
+	for _, key := range in.Keys {
+		item := &pb.BatchItem{Response: &pb.GetResponse{}}
+		if v, ok := p.values[key]; ok {
+			item.Response.Value = v
+		} else if key == "bad" {
+			item.Error = "db error"
+		} else {
+			item.Response.NotFound = true
+		}
+		out.Items = append(out.Items, item)
+	}
+	return nil
+}
+
+// mapPicker 按照 owners 选择 key 的拥有者，不在 owners 中的 key 由本地处理
+type mapPicker struct {
+	owners map[string]PeerGetter
+}
+
+func (p *mapPicker) PickPeer(key string) (PeerGetter, bool) {
+	peer, ok := p.owners[key]
+	return peer, ok
+}
+
+func (p *mapPicker) PickPeers(key string, n int) []PeerGetter {
+	if peer, ok := p.owners[key]; ok {
+		return []PeerGetter{peer}
+	}
+	return nil
+}
+
+func (p *mapPicker) AllPeers() []PeerGetter {
+	return nil
+}
+
+// 属于远程节点的 key 按拥有者批量获取，不支持批量获取的节点逐个获取，属于本地的 key 从数据源批量加载
+func TestGetMultiPeers(t *testing.T) {
+	getter := &batchGetter{}
+	gee, err := NewGroupWithOptions("multi-peer-scores", getter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batchPeer := &fakeBatchPeer{fakePeer: &fakePeer{values: map[string][]byte{"a1": []byte("1"), "a2": []byte("2")}}}
+	plainPeer := &fakePeer{values: map[string][]byte{"b1": []byte("3"), "b2": []byte("4")}}
+	gee.RegisterPeers(&mapPicker{owners: map[string]PeerGetter{
+		"a1": batchPeer, "a2": batchPeer, "a3": batchPeer, "bad": batchPeer,
+		"b1": plainPeer, "b2": plainPeer,
+	}})
+	values, err := gee.GetMulti(context.Background(), []string{"a1", "b1", "Tom", "a2", "b2", "a3", "bad", "Jack"})
+	if !errors.Is(err, ErrPeer) || !strings.Contains(err.Error(), "db error") {
+		t.Fatalf("error of bad should be returned as ErrPeer, but got %v", err)
+	}
+	expect := map[string]string{"a1": "1", "a2": "2", "b1": "3", "b2": "4", "Tom": "630", "Jack": "589"}
+	if len(values) != len(expect) {
+		t.Fatalf("expect %d values, but got %v", len(expect), values)
+	}
+	for key, v := range expect {
+		if values[key].String() != v {
+			t.Fatalf("expect %s=%s, but got %s", key, v, values[key])
+		}
+	}
+	if !reflect.DeepEqual([][]string{{"a1", "a2", "a3", "bad"}}, batchPeer.batches) || batchPeer.gets.Get() != 0 {
+		t.Fatalf("keys of the same owner should be fetched in one batch, but got %v", batchPeer.batches)
+	}
+	if plainPeer.gets.Get() != 2 {
+		t.Fatalf("peer without GetBatch should be asked key by key, but got %d gets", plainPeer.gets.Get())
+	}
+	if !reflect.DeepEqual([][]string{{"Tom", "Jack"}}, getter.batches) {
+		t.Fatalf("local misses should be loaded in one batch, but got %v", getter.batches)
+	}
+}
+
+// slowPeer 是不支持 GetBatch 的远程节点，每次 Get 都需要一段时间，记录同时处理的最大请求数
+type slowPeer struct {
+	*fakePeer
+	mu                  sync.Mutex
+	running, maxRunning int
+}
+
+func (p *slowPeer) Get(ctx context.Context, in *pb.Request, out *pb.GetResponse) error {
+	p.mu.Lock()
+	p.running++
+	if p.running > p.maxRunning {
+		p.maxRunning = p.running
+	}
+	p.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	p.mu.Lock()
+	p.running--
+	p.mu.Unlock()
+	out.Value = []byte(in.Key)
+	return nil
+}
+
+// 远程节点不支持批量获取时，逐个获取的 key 并发进行，同时进行的请求不超过 maxConcurrentLoads 个
+func TestGetMultiFallbackConcurrent(t *testing.T) {
+	gee, err := NewGroupWithOptions("multi-fallback-scores", &batchGetter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := &slowPeer{fakePeer: &fakePeer{}}
+	owners := make(map[string]PeerGetter)
+	keys := make([]string, 3*maxConcurrentLoads)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		owners[keys[i]] = peer
+	}
+	gee.RegisterPeers(&mapPicker{owners: owners})
+	values, err := gee.GetMulti(context.Background(), keys)
+	if err != nil || len(values) != len(keys) {
+		t.Fatalf("expect %d values, but got %d, %v", len(keys), len(values), err)
+	}
+	if max := peer.maxRunning; max < 2 || max > maxConcurrentLoads {
+		t.Fatalf("expect at most %d concurrent gets, but got %d", maxConcurrentLoads, max)
+	}
+}
@@ -4,73 +4,187 @@ import (
 	"Geecache/geecache/consistenthash"
 	pb "Geecache/geecache/geecachepb"
 	"Geecache/geecache/registry"
+	"Geecache/geecache/tlsutil"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"google.golang.org/protobuf/proto"
+	"hash/crc32"
+	"io"
 	"log"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/naming/endpoints"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 const (
-	defaultReplicas = 50 //默认虚拟节点数量
+	defaultReplicas = 50          //默认虚拟节点数量
+	watchRetryDelay = time.Second //监听etcd中断后重新监听的等待时间
+	maxMessageSize  = 4 << 20     //节点之间 gRPC 消息的最大长度，即 gRPC 默认的接收限制，服务端和客户端都显式设置为该值
+	streamChunkSize = 1 << 20     //GetStream 每一块的最大长度，远小于 maxMessageSize
+	//GetV2 和 GetBatch 直接返回的缓存值的最大长度，为 maxMessageSize 留出其他字段的空间，更大的缓存值通过 GetStream 分块传输
+	maxInlineValue    = maxMessageSize - 1<<10
+	batchItemOverhead = 8 //BatchResponse 中每一项的字段标签和长度前缀占用的最大长度
 )
 
 // server 模块为geecache之间提供通信能力
 // 这样部署在其他机器上的cache可以通过访问server获取缓存
 // 至于找哪台主机 那是一致性哈希的工作了
 
-var (
-	//这个变量通常用于创建etcd客户端的配置，当你不需要定制化的配置时，可以直接使用 defaultEtcdConfig 这个预定义的配置。
-	defaultEtcdConfig = clientv3.Config{
-		Endpoints:   []string{"localhost:2379"}, // etcd服务器的地址，这里使用本地地址和默认端口
-		DialTimeout: 5 * time.Second,            // 建立连接的超时时间为5秒
-	}
-)
-
 // Server 和 Group 是解耦合的 所以server要自己实现并发控制
 type Server struct {
-	pb.UnimplementedGroupCacheServer                     //gRPC 自动生成的代码，用于实现 gRPC 的服务端接口。
-	self                             string              // 当前服务器的地址，format: ip:port
-	status                           bool                // 当前服务器的运行状态，true: running false: stop
-	stopSignal                       chan error          // 用于接收通知，通知服务器停止运行。通常是其他组件发出的信号，例如 registry 服务，用于通知当前服务停止运行。
-	mu                               sync.Mutex          //保护共享资源的互斥锁
-	peers                            *consistenthash.Map //一致性哈希（consistent hash）映射，用于确定缓存数据在集群中的分布。
-	clients                          map[string]*Client  //用于存储其他节点的客户端连接。键是其他节点的地址，值是与该节点建立的客户端连接
+	pb.UnimplementedGroupCacheServer                    //gRPC 自动生成的代码，用于实现 gRPC 的服务端接口。
+	self                             string             // 当前服务器的地址，format: ip:port
+	status                           bool               // 当前服务器的运行状态，true: running false: stop
+	stopSignal                       chan error         // 用于接收通知，通知服务器停止运行。通常是其他组件发出的信号，例如 registry 服务，用于通知当前服务停止运行。
+	mu                               sync.Mutex         //保护共享资源的互斥锁
+	peers                            Placement          //节点选择算法，默认为一致性哈希（consistent hash），用于确定缓存数据在集群中的分布。
+	newPlacement                     func() Placement   //每次集群节点变化时用它创建新的 peers
+	clients                          map[string]*Client //用于存储其他节点的客户端连接。键是其他节点的地址，值是与该节点建立的客户端连接
+	weight                           int                //当前节点的权重，注册至etcd后由其他节点用于构建一致性哈希环
+	members                          map[string]int     //当前集群中的所有节点地址及其权重，peers 和 clients 都由它构建
+	cancelWatch                      context.CancelFunc //停止监听etcd中的节点变化
+	loadFactor                       float64            //有界负载模式的负载系数，为 0 时关闭有界负载模式
+	inflight                         AtomicInt          //当前节点正在处理的远程节点的 Get 请求数量，即当前节点的负载
+	tlsConfig                        *tlsutil.Config    //节点之间 gRPC 连接的 TLS 配置，为 nil 时使用明文连接
+	registry                         registry.Config    //访问etcd以及注册服务的配置，用于注册、监听节点和发现其他节点
+	clientOpts                       []ClientOption     //创建其他节点的客户端时使用的选项
+	// creds 是由 tlsConfig 创建的服务端凭证，没有设置 tlsConfig 时为明文
+	creds credentials.TransportCredentials
+}
+
+// ServerOption 用于在创建 Server 时修改默认配置
+type ServerOption func(*Server)
+
+// WithWeight 设置当前节点的权重，默认为 1。权重越大，节点在一致性哈希环上的虚拟节点越多，分到的 key 也越多，
+// 适用于集群中机器内存大小不一致的场景。jumphash 不支持权重，使用它时所有节点的权重都视为 1
+func WithWeight(weight int) ServerOption {
+	return func(s *Server) {
+		s.weight = weight
+	}
+}
+
+// WithPlacement 设置节点选择算法，newPlacement 在每次集群节点变化时被调用，返回一个空的 Placement。
+// 默认为虚拟节点倍数是 50 的一致性哈希环，集群中所有节点必须使用相同的算法，否则它们对 key 的拥有者的判断会不一致
+func WithPlacement(newPlacement func() Placement) ServerOption {
+	return func(s *Server) {
+		s.newPlacement = newPlacement
+	}
+}
+
+// WithBoundedLoad 开启有界负载模式，c 是负载系数，必须不小于 1。
+// 每个节点的负载是正在进行的请求数量：当前节点是正在处理的远程 Get 请求数，其他节点是当前节点发往它的请求数。
+// key 的拥有者的负载超过 c 倍的平均负载时，请求会转给环上的下一个节点，从而分散热点 key 集中的节点的压力。
+// 只有支持有界负载的 Placement（consistenthash）可以使用该选项
+func WithBoundedLoad(c float64) ServerOption {
+	return func(s *Server) {
+		s.loadFactor = c
+	}
+}
+
+// WithTLS 使节点之间的 gRPC 连接使用 TLS，cfg 同时用于当前节点的服务端和访问其他节点的客户端。
+// cfg.CAFile 不为空时开启双向 TLS：服务端要求客户端出示由这些 CA 签发的证书，客户端出示自己的证书。
+// 节点通过 IP 地址互相访问，证书中需要包含节点的 IP 地址，或者通过 cfg.ServerName 指定证书中的名称。
+// 集群中的所有节点需要同时开启或关闭 TLS
+func WithTLS(cfg tlsutil.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = &cfg
+	}
+}
+
+// WithRegistry 设置etcd的地址、身份认证、TLS、租约有效期以及服务名称前缀，默认访问 localhost:2379 并注册在 geecache 下。
+// 其他节点的客户端使用相同的配置发现节点。前缀不同的节点互相不可见，多个集群可以共用一个etcd
+func WithRegistry(cfg registry.Config) ServerOption {
+	return func(s *Server) {
+		s.registry = cfg
+	}
+}
+
+// boundedPlacement 是支持有界负载模式的 Placement
+type boundedPlacement interface {
+	Placement
+	SetBoundedLoad(c float64, load func(node string) int64)
+}
+
+// defaultPlacement 返回默认的一致性哈希环
+func defaultPlacement() Placement {
+	return consistenthash.New(defaultReplicas, nil)
 }
 
 // NewServer 创建cache的 Server
-func NewServer(self string) (*Server, error) {
-	return &Server{
-		self:    self,
-		peers:   consistenthash.New(defaultReplicas, nil),
-		clients: map[string]*Client{},
-	}, nil
+func NewServer(self string, opts ...ServerOption) (*Server, error) {
+	s := &Server{
+		self:         self,
+		weight:       1,
+		newPlacement: defaultPlacement,
+		clients:      map[string]*Client{},
+		members:      map[string]int{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.weight < 1 {
+		return nil, fmt.Errorf("invalid weight %d", s.weight)
+	}
+	if s.newPlacement == nil {
+		return nil, fmt.Errorf("placement required")
+	}
+	s.peers = s.newPlacement()
+	if s.loadFactor != 0 {
+		if s.loadFactor < 1 {
+			return nil, fmt.Errorf("invalid load factor %v", s.loadFactor)
+		}
+		if _, ok := s.peers.(boundedPlacement); !ok {
+			return nil, fmt.Errorf("placement %T does not support bounded load", s.peers)
+		}
+	}
+	s.creds = insecure.NewCredentials()
+	if s.tlsConfig != nil {
+		serverTLS, err := s.tlsConfig.ServerConfig()
+		if err != nil {
+			return nil, err
+		}
+		clientTLS, err := s.tlsConfig.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		s.creds = credentials.NewTLS(serverTLS)
+		s.clientOpts = append(s.clientOpts, WithClientTLS(clientTLS))
+	}
+	if err := s.registry.Validate(); err != nil {
+		return nil, err
+	}
+	s.clientOpts = append(s.clientOpts, WithClientRegistry(s.registry))
+	return s, nil
 }
 
-// Get 实现了 Server 结构体用于处理 gRPC 客户端的请求
+// Get 是第一版的 Get RPC，Response.Value 中是编码后的另一个 Response，
+// 只用于兼容还没有升级、不支持 GetV2 的客户端。旧的客户端不认识 NotFound 字段，会把空的 Value 当作空的缓存值，
+// 所以 key 不存在时返回 codes.NotFound 错误
 func (s *Server) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
-	group, key := in.Group, in.Key
 	resp := &pb.Response{}
-	log.Printf("[Geecache_svr %s] Recv RPC Request - (%s)/(%s)", s.self, group, key)
-	if key == "" {
-		return resp, fmt.Errorf("key required")
+	view, err := s.getView(ctx, in)
+	if errors.Is(err, ErrNotFound) {
+		return resp, status.Error(codes.NotFound, err.Error())
 	}
-	g := GetGroup(group)
-	if g == nil {
-		return resp, fmt.Errorf("group not found")
-	}
-	view, err := g.Get(key)
 	if err != nil {
 		return resp, err
 	}
 	//将获取到的缓存数据序列化为 protobuf 格式，并存储在响应对象的 Value 字段中
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice(), Expire: expireMilli(view)})
 	if err != nil {
 		log.Printf("encoding response body:%v", err)
 	}
@@ -78,6 +192,167 @@ func (s *Server) Get(ctx context.Context, in *pb.Request) (*pb.Response, error)
 	return resp, nil
 }
 
+// GetV2 是第二版的 Get RPC，直接返回缓存值以及过期时间、版本等元数据。
+// 缓存值超过 maxInlineValue 时返回 codes.ResourceExhausted，客户端应改用 GetStream
+func (s *Server) GetV2(ctx context.Context, in *pb.Request) (*pb.GetResponse, error) {
+	resp := &pb.GetResponse{}
+	view, err := s.getView(ctx, in)
+	if errors.Is(err, ErrNotFound) {
+		resp.NotFound = true
+		return resp, nil
+	}
+	if err != nil {
+		return resp, err
+	}
+	if view.Len() > maxInlineValue {
+		return resp, status.Errorf(codes.ResourceExhausted, "value of %d bytes is too large, use GetStream", view.Len())
+	}
+	fillResponse(resp, view)
+	return resp, nil
+}
+
+// GetStream 把缓存值分成不超过 streamChunkSize 的多块发送，第一块携带完整长度、校验和以及过期时间等元数据。
+// key 不存在时只发送一个 NotFound 的块
+func (s *Server) GetStream(in *pb.Request, stream pb.GroupCache_GetStreamServer) error {
+	view, err := s.getView(stream.Context(), in)
+	if errors.Is(err, ErrNotFound) {
+		return stream.Send(&pb.Chunk{NotFound: true})
+	}
+	if err != nil {
+		return err
+	}
+	chunk := &pb.Chunk{Size: int64(view.Len()), Checksum: crc32.ChecksumIEEE(view.b), Expire: expireMilli(view)}
+	if !view.t.IsZero() {
+		chunk.Version = view.t.UnixNano()
+	}
+	for offset := 0; ; offset += streamChunkSize {
+		end := offset + streamChunkSize
+		if end > view.Len() {
+			end = view.Len()
+		}
+		chunk.Data = view.b[offset:end] //缓存值是只读的，Send 会在返回前把它编码到新的缓冲区
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+		if end == view.Len() {
+			return nil
+		}
+		chunk = &pb.Chunk{}
+	}
+}
+
+// fillResponse 把缓存值和元数据写入 GetV2 和 GetBatch 的响应
+func fillResponse(resp *pb.GetResponse, view ByteView) {
+	resp.Value = view.b //缓存值是只读的，gRPC 在发送时会把它编码到新的缓冲区，不需要拷贝
+	resp.Expire = expireMilli(view)
+	if !view.t.IsZero() {
+		resp.Version = view.t.UnixNano()
+	}
+}
+
+// GetBatch 处理远程节点的批量获取请求，请求中的 key 都属于当前节点，缺失的 key 一起从数据源加载。
+// 单个 key 失败时通过 BatchItem.Error 返回，不影响其他 key。响应的长度将要超过 maxInlineValue 时，
+// 剩下的缓存值不放在响应中，只标记 TooLarge，由客户端单独获取
+func (s *Server) GetBatch(ctx context.Context, in *pb.BatchRequest) (*pb.BatchResponse, error) {
+	log.Printf("[Geecache_svr %s] Recv RPC GetBatch - (%s)/(%d keys)", s.self, in.Group, len(in.Keys))
+	g := GetGroup(in.Group)
+	if g == nil {
+		return &pb.BatchResponse{}, fmt.Errorf("group not found")
+	}
+	s.inflight.Add(1)
+	defer s.inflight.Add(-1)
+	values, errs := g.getMulti(withPeerRequest(ctx), in.Keys)
+	resp := &pb.BatchResponse{Items: make([]*pb.BatchItem, len(in.Keys))}
+	inline := 0 //响应编码后的长度，不超过 maxInlineValue
+	for i, key := range in.Keys {
+		item := &pb.BatchItem{Response: &pb.GetResponse{}}
+		if view, ok := values[key]; ok {
+			fillResponse(item.Response, view)
+		} else if err := errs[key]; errors.Is(err, ErrNotFound) {
+			item.Response.NotFound = true
+		} else if err != nil {
+			item.Error = err.Error()
+		}
+		size := proto.Size(item) + batchItemOverhead
+		if inline+size > maxInlineValue {
+			item = &pb.BatchItem{Response: &pb.GetResponse{}, TooLarge: true} //响应中放不下，由客户端单独获取
+			size = proto.Size(item) + batchItemOverhead
+		}
+		inline += size
+		resp.Items[i] = item
+	}
+	return resp, nil
+}
+
+// getView 从对应的缓存组中获取缓存值，是两个版本的 Get 共用的部分
+func (s *Server) getView(ctx context.Context, in *pb.Request) (ByteView, error) {
+	group, key := in.Group, in.Key
+	log.Printf("[Geecache_svr %s] Recv RPC Request - (%s)/(%s)", s.self, group, key)
+	if key == "" {
+		return ByteView{}, fmt.Errorf("key required")
+	}
+	g := GetGroup(group)
+	if g == nil {
+		return ByteView{}, fmt.Errorf("group not found")
+	}
+	s.inflight.Add(1)
+	defer s.inflight.Add(-1)
+	return g.GetContext(withPeerRequest(ctx), key) //ctx 携带了调用方设置的截止时间
+}
+
+// expireMilli 返回缓存值以 Unix 毫秒表示的过期时间，未知时返回 0
+func expireMilli(view ByteView) int64 {
+	if view.e.IsZero() {
+		return 0
+	}
+	return view.e.UnixMilli()
+}
+
+// Put 处理远程节点的写入请求，当前节点是该 key 的拥有者
+func (s *Server) Put(ctx context.Context, in *pb.PutRequest) (*pb.Empty, error) {
+	log.Printf("[Geecache_svr %s] Recv RPC Put - (%s)/(%s)", s.self, in.Group, in.Key)
+	g, err := s.lookupGroup(in.Group, in.Key)
+	if err != nil {
+		return &pb.Empty{}, err
+	}
+	g.setLocally(in.Key, in.Value, time.Duration(in.Ttl)*time.Millisecond)
+	return &pb.Empty{}, nil
+}
+
+// Remove 处理远程节点的删除请求，当前节点是该 key 的拥有者
+func (s *Server) Remove(ctx context.Context, in *pb.Request) (*pb.Empty, error) {
+	log.Printf("[Geecache_svr %s] Recv RPC Remove - (%s)/(%s)", s.self, in.Group, in.Key)
+	g, err := s.lookupGroup(in.Group, in.Key)
+	if err != nil {
+		return &pb.Empty{}, err
+	}
+	g.removeLocally(in.Key)
+	return &pb.Empty{}, nil
+}
+
+// Invalidate 处理远程节点的失效通知，删除当前节点hotCache中的副本，当前节点不是拥有者时还会删除mainCache中的副本
+func (s *Server) Invalidate(ctx context.Context, in *pb.Request) (*pb.Empty, error) {
+	log.Printf("[Geecache_svr %s] Recv RPC Invalidate - (%s)/(%s)", s.self, in.Group, in.Key)
+	g, err := s.lookupGroup(in.Group, in.Key)
+	if err != nil {
+		return &pb.Empty{}, err
+	}
+	g.invalidateLocally(in.Key)
+	return &pb.Empty{}, nil
+}
+
+// lookupGroup 校验请求参数并返回对应的缓存组
+func (s *Server) lookupGroup(group, key string) (*Group, error) {
+	if key == "" {
+		return nil, fmt.Errorf("key required")
+	}
+	g := GetGroup(group)
+	if g == nil {
+		return nil, fmt.Errorf("group not found")
+	}
+	return g, nil
+}
+
 // Start  方法负责启动缓存服务，监听指定端口，注册 gRPC 服务至服务器，并在接收到停止信号后关闭服务
 func (s *Server) Start() error {
 	s.mu.Lock()
@@ -102,15 +377,20 @@ func (s *Server) Start() error {
 	if err != nil {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.Creds(s.creds), grpc.MaxRecvMsgSize(maxMessageSize), grpc.MaxSendMsgSize(maxMessageSize))
 	pb.RegisterGroupCacheServer(grpcServer, s)
 	//创建一个新的 gRPC 服务器 grpcServer，然后将当前的 Server 对象 s 注册为 gRPC 服务。
 	//这样，gRPC 服务器就能够处理来自客户端的请求。
 
+	// 6. 监听etcd中其他节点的上线与下线，实时重建一致性哈希环
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancelWatch = cancel
+	go s.watchPeers(ctx)
+
 	go func() {
 		// 注册服务至 etcd。该操作会一直阻塞，直到停止信号被接收。
 		//当停止信号被接收后，关闭通知通道 s.stopSignal，关闭 TCP 监听端口，并输出日志表示服务已经停止。
-		err := registry.Register("geecache", s.self, s.stopSignal)
+		err := registry.Register(s.registry, s.self, registry.Metadata{Weight: s.weight}, s.stopSignal)
 		if err != nil {
 			log.Fatalf(err.Error())
 		}
@@ -135,13 +415,140 @@ func (s *Server) Start() error {
 }
 
 // Set 方法用于设置其他缓存节点的地址信息，并为每个节点创建相应的客户端连接
+// Start 之后集群节点以etcd中注册的节点为准，Set 设置的地址只作为启动时的初始节点，除自己以外的节点权重为 1
 func (s *Server) Set(peersAddr ...string) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.peers.Add(peersAddr...)            //将传入的所有节点地址批量添加到一致性哈希映射 s.peers 中
-	for _, peerAddr := range peersAddr { //遍历传入的节点地址列表 peersAddr，为每个节点创建一个客户端连接
-		service := fmt.Sprintf("geecache/%s", peerAddr) //客户端的服务名（service）由节点地址构成，并且遵循一定的命名规则（在这里是 geecache/<peerAddr>）。
-		s.clients[peerAddr] = NewClient(service)        //然后，使用 NewClient(service) 函数创建一个新的客户端连接，并将连接对象存储在 s.clients 映射中，以便后续通过节点地址进行查找和通信
+	members := make(map[string]int, len(s.members)+len(peersAddr))
+	for addr, weight := range s.members {
+		members[addr] = weight
+	}
+	for _, peerAddr := range peersAddr {
+		if _, ok := members[peerAddr]; !ok {
+			members[peerAddr] = s.weightOf(peerAddr, 1)
+		}
+	}
+	removed := s.rebuildLocked(members)
+	s.mu.Unlock()
+	closeClients(removed)
+}
+
+// rebuildLocked 根据节点列表及其权重重新构建 peers 和客户端连接，并一次性替换旧的状态，
+// 返回不再属于集群的客户端，由调用方在释放锁之后关闭。调用方需要持有 s.mu
+func (s *Server) rebuildLocked(members map[string]int) []*Client {
+	addrs := make([]string, 0, len(members))
+	for addr := range members {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	peers := s.newPlacement()
+	for _, addr := range addrs {
+		if wp, ok := peers.(weightedPlacement); ok {
+			wp.AddWeighted(addr, members[addr]) //将所有节点地址按权重添加到新的 peers 中
+		} else {
+			peers.Add(addr)
+		}
+	}
+	clients := make(map[string]*Client, len(addrs))
+	if bp, ok := peers.(boundedPlacement); ok && s.loadFactor != 0 {
+		bp.SetBoundedLoad(s.loadFactor, func(addr string) int64 {
+			if addr == s.self {
+				return s.inflight.Get()
+			}
+			return clients[addr].load()
+		})
+	}
+	for _, peerAddr := range addrs { //遍历节点地址列表，为每个节点创建一个客户端连接
+		if client, ok := s.clients[peerAddr]; ok {
+			clients[peerAddr] = client //已经存在的客户端继续复用它的长连接
+			continue
+		}
+		//客户端通过etcd发现 <Prefix>/<peerAddr> 服务，默认的前缀是 geecache。
+		clients[peerAddr] = NewClient(peerAddr, s.clientOpts...) //然后，使用 NewClient(peerAddr) 函数创建一个新的客户端连接，并将连接对象存储在 clients 映射中，以便后续通过节点地址进行查找和通信
+	}
+	var removed []*Client
+	for addr, client := range s.clients {
+		if _, ok := members[addr]; !ok {
+			removed = append(removed, client)
+		}
+	}
+	s.peers, s.clients, s.members = peers, clients, members
+	return removed
+}
+
+// watchPeers 持续监听集群节点的变化，监听中断后等待一段时间重新监听，直到 ctx 被取消
+func (s *Server) watchPeers(ctx context.Context) {
+	cli, err := s.registry.NewClient()
+	if err != nil {
+		log.Printf("[%s] create etcd client for watching failed: %v", s.self, err)
+		return
+	}
+	defer cli.Close()
+	for {
+		wc, err := registry.Watch(ctx, cli, s.registry)
+		if err != nil {
+			log.Printf("[%s] watch peers failed: %v", s.self, err)
+		} else {
+			reset := true //每次重新监听后的第一批更新是完整的节点列表
+			for updates := range wc {
+				s.applyUpdates(updates, reset)
+				reset = false
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetryDelay):
+		}
+	}
+}
+
+// applyUpdates 将一批节点变化应用到集群节点列表，reset 为 true 时 updates 是完整的节点列表。
+// 自己始终属于集群，因为只有在处理请求时才会用到哈希环。
+func (s *Server) applyUpdates(updates []*endpoints.Update, reset bool) {
+	s.mu.Lock()
+	if s.peers == nil { //server 已经停止
+		s.mu.Unlock()
+		return
+	}
+	members := map[string]int{s.self: s.weight}
+	if !reset {
+		for addr, weight := range s.members {
+			members[addr] = weight
+		}
+	}
+	for _, up := range updates {
+		addr := up.Endpoint.Addr //registry.Watch 从 key 中解析出地址，删除事件中也有
+		switch up.Op {
+		case endpoints.Add:
+			weight := 1 //没有权重信息的节点权重为 1
+			if meta, ok := up.Endpoint.Metadata.(registry.Metadata); ok && meta.Weight > 0 {
+				weight = meta.Weight
+			}
+			members[addr] = s.weightOf(addr, weight)
+		case endpoints.Delete:
+			if addr != s.self {
+				delete(members, addr)
+			}
+		}
+	}
+	removed := s.rebuildLocked(members)
+	s.mu.Unlock()
+	closeClients(removed)
+	log.Printf("[%s] peers changed, %d members now", s.self, len(members))
+}
+
+// weightOf 返回节点的权重，自己的权重以本地配置为准
+func (s *Server) weightOf(addr string, weight int) int {
+	if addr == s.self {
+		return s.weight
+	}
+	return weight
+}
+
+// closeClients 关闭已经离开集群的节点的连接
+func closeClients(clients []*Client) {
+	for _, client := range clients {
+		client.Close()
 	}
 }
 
@@ -158,6 +565,45 @@ func (s *Server) PickPeer(key string) (PeerGetter, bool) {
 	return s.clients[peerAddr], true //如果选择的节点不是当前服务器本身，日志会记录当前服务器选择了远程对等节点，并且函数会返回选择的对等节点的客户端连接（s.clients[peerAddr]）和 true，表示选择成功
 }
 
+// PickPeers 方法按优先级返回负责该 key 的最多 n 个远程节点的客户端连接，遇到自己时截止。
+// 有界负载模式下 key 的拥有者可能不是 GetN 返回的第一个节点，此时把拥有者移到最前面
+func (s *Server) PickPeers(key string, n int) []PeerGetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addrs := s.peers.GetN(key, n)
+	if owner := s.peers.Get(key); len(addrs) > 0 && addrs[0] != owner {
+		ordered := append(make([]string, 0, n), owner)
+		for _, addr := range addrs {
+			if addr != owner && len(ordered) < n {
+				ordered = append(ordered, addr)
+			}
+		}
+		addrs = ordered
+	}
+	peers := make([]PeerGetter, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr == s.self {
+			break
+		}
+		peers = append(peers, s.clients[addr])
+	}
+	return peers
+}
+
+// AllPeers 方法返回除自己以外所有节点的客户端连接，用于广播失效通知
+func (s *Server) AllPeers() []PeerGetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	peers := make([]PeerGetter, 0, len(s.clients))
+	for addr, client := range s.clients {
+		if addr == s.self {
+			continue
+		}
+		peers = append(peers, client)
+	}
+	return peers
+}
+
 // Stop 停止server运行 如果server没有运行 这将是一个no-op
 func (s *Server) Stop() {
 	s.mu.Lock()
@@ -167,8 +613,13 @@ func (s *Server) Stop() {
 	}
 	s.stopSignal <- nil // 发送停止keepalive信号
 	s.status = false    // 设置server运行状态为stop
-	s.clients = nil     // 清空一致性哈希信息 有助于垃圾回收
-	s.peers = nil       // 清空一致性哈希映射
+	s.cancelWatch()     // 停止监听节点变化
+	for _, client := range s.clients {
+		client.Close() // 关闭与其他节点的长连接
+	}
+	s.clients = nil // 清空一致性哈希信息 有助于垃圾回收
+	s.peers = nil   // 清空一致性哈希映射
+	s.members = nil
 	s.mu.Unlock()
 }
 
@@ -176,44 +627,426 @@ func (s *Server) Stop() {
 var _ PeerPicker = (*Server)(nil)
 
 // Client 模块实现geecache访问其他远程节点,从而获取缓存的能力
+// Client 会为对应的远程节点保持一个长连接，多次请求复用同一个 grpc.ClientConn，
+// 连接断开后由 gRPC 按照退避策略自动重连，空闲超过 idleTimeout 的连接会被关闭，下次请求时重新建立。
 type Client struct {
-	baseURL string // 服务名称 geecache/ip:addr
+	addr        string               // 远程节点的地址，format: ip:port
+	idleTimeout time.Duration        // 连接的最长空闲时间
+	mu          sync.Mutex           // 保护下面的连接状态
+	etcdCli     *clientv3.Client     // 用于服务发现的etcd客户端，与 conn 的生命周期相同
+	conn        *grpc.ClientConn     // 与远程节点的长连接
+	dialErr     error                // 最近一次建立连接失败的错误
+	retryAt     time.Time            // 建立连接失败后，在此时间之前直接返回 dialErr
+	failures    int                  // 连续建立连接失败的次数，用于计算退避时间
+	lastUsed    time.Time            // 最近一次使用连接的时间
+	inflight    AtomicInt            // 正在使用连接的请求数量，大于 0 时不会因为空闲而关闭连接，load 不加锁读取
+	closed      bool                 // Close 之后不再建立新的连接
+	dialing     chan struct{}        // 正在建立连接时不为 nil，建立成功或失败后关闭
+	cancelDial  context.CancelFunc   // 中断正在建立的连接
+	stop        chan struct{}        // 通知空闲检查协程退出
+	unsupported map[string]time.Time // 远程节点不支持的 RPC，在对应的时间之前直接使用旧的 RPC
+	registry    registry.Config      // 访问etcd以及发现远程节点的配置
+	// creds 是与远程节点连接的传输层凭证，默认为明文
+	creds credentials.TransportCredentials
+	// dial 用于建立连接，为 nil 时通过etcd发现远程节点，测试时可以替换为直连
+	dial func(ctx context.Context) (*grpc.ClientConn, error)
 }
 
-// Get 方法允许 Client 结构体实例向远程节点发送请求，获取缓存数据，并将响应解码为 pb.Response 结构体。
-func (g *Client) Get(in *pb.Request, out *pb.Response) error {
-	cli, err := clientv3.New(defaultEtcdConfig) // 创建一个etcd客户端
+const (
+	defaultIdleTimeout = 5 * time.Minute        // 默认的连接最长空闲时间
+	dialBaseDelay      = 100 * time.Millisecond // 建立连接失败后的首次退避时间
+	dialMaxDelay       = 10 * time.Second       // 建立连接失败后的最长退避时间
+	legacyRetry        = time.Minute            // 远程节点不支持新的 RPC 时，隔多久再尝试一次
+	dialTimeout        = 10 * time.Second       // 一次建立连接（包括通过etcd发现节点）的超时时间
+)
+
+// 可能不被旧节点支持的 RPC 的名称
+const (
+	methodGetV2     = "GetV2"
+	methodGetBatch  = "GetBatch"
+	methodGetStream = "GetStream"
+)
+
+// Get 方法允许 Client 结构体实例向远程节点发送请求，获取缓存数据，并将响应写入 out。
+// 优先使用 GetV2，远程节点返回 Unimplemented 时说明它还没有升级，改用第一版的 Get，
+// 并在 legacyRetry 时间内直接使用第一版，之后再尝试 GetV2，使滚动升级期间新旧节点可以互相访问。
+// 缓存值太大、无法放在一个消息中时（codes.ResourceExhausted），改用 GetStream 分块获取。
+// 等待建立连接以及 gRPC 请求都受 ctx 的超时与取消控制。
+func (g *Client) Get(ctx context.Context, in *pb.Request, out *pb.GetResponse) error {
+	if g.supports(methodGetV2) {
+		var response *pb.GetResponse
+		err := g.call(ctx, func(grpcClient pb.GroupCacheClient) (err error) {
+			response, err = grpcClient.GetV2(ctx, in) //ctx 的截止时间会随 gRPC 请求传递给远程节点
+			return err
+		})
+		if status.Code(err) == codes.ResourceExhausted && g.supports(methodGetStream) {
+			return g.getStream(ctx, in, out, err)
+		}
+		if status.Code(err) != codes.Unimplemented {
+			if err != nil {
+				return fmt.Errorf("reading response body:%v", err)
+			}
+			out.Value, out.Expire, out.Version, out.NotFound = response.Value, response.Expire, response.Version, response.NotFound
+			return nil
+		}
+		g.setUnsupported(methodGetV2)
+	}
+	return g.getV1(ctx, in, out)
+}
+
+// getV1 使用第一版的 Get 获取缓存数据，响应需要解码两次，没有版本信息
+func (g *Client) getV1(ctx context.Context, in *pb.Request, out *pb.GetResponse) error {
+	var response *pb.Response
+	err := g.call(ctx, func(grpcClient pb.GroupCacheClient) (err error) {
+		response, err = grpcClient.Get(ctx, in)
+		return err
+	})
+	if status.Code(err) == codes.NotFound { //第一版的 Get 通过错误码返回不存在的 key
+		out.NotFound = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading response body:%v", err)
+	}
+	inner := &pb.Response{}
+	if err = proto.Unmarshal(response.GetValue(), inner); err != nil {
+		return fmt.Errorf("decoding response body:%v", err)
+	}
+	out.Value, out.Expire = inner.Value, inner.Expire
+	return nil
+}
+
+// getStream 通过 GetStream 分块获取缓存值，拼接完成后检查长度和校验和。
+// 远程节点不支持 GetStream 时返回 GetV2 的错误 tooLarge，并在 legacyRetry 时间内不再尝试
+func (g *Client) getStream(ctx context.Context, in *pb.Request, out *pb.GetResponse, tooLarge error) error {
+	err := g.call(ctx, func(grpcClient pb.GroupCacheClient) error {
+		stream, err := grpcClient.GetStream(ctx, in)
+		if err != nil {
+			return err
+		}
+		head, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if head.NotFound {
+			out.NotFound = true
+			return nil
+		}
+		if head.Size < 0 {
+			return fmt.Errorf("invalid value size %d", head.Size)
+		}
+		//head.Size 来自远程节点，不能完全信任，预先分配的内存不超过 maxMessageSize，之后随收到的数据增长
+		capacity := head.Size
+		if capacity > maxMessageSize {
+			capacity = maxMessageSize
+		}
+		value := make([]byte, 0, capacity)
+		for chunk := head; ; {
+			if len(value)+len(chunk.Data) > int(head.Size) {
+				return fmt.Errorf("value is longer than %d bytes", head.Size)
+			}
+			value = append(value, chunk.Data...)
+			if chunk, err = stream.Recv(); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+		if len(value) != int(head.Size) {
+			return fmt.Errorf("value is truncated, got %d of %d bytes", len(value), head.Size)
+		}
+		if crc32.ChecksumIEEE(value) != head.Checksum {
+			return fmt.Errorf("checksum mismatch")
+		}
+		out.Value, out.Expire, out.Version = value, head.Expire, head.Version
+		return nil
+	})
+	if status.Code(err) == codes.Unimplemented {
+		g.setUnsupported(methodGetStream)
+		return fmt.Errorf("reading response body:%v", tooLarge)
+	}
 	if err != nil {
+		return fmt.Errorf("reading stream:%v", err)
+	}
+	return nil
+}
+
+// GetBatch 方法请求远程节点一次获取多个 key。远程节点还没有升级、不支持 GetBatch 时返回 errBatchUnsupported，
+// 并在 legacyRetry 时间内不再尝试，由调用方逐个获取
+func (g *Client) GetBatch(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	if !g.supports(methodGetBatch) {
+		return errBatchUnsupported
+	}
+	var response *pb.BatchResponse
+	err := g.call(ctx, func(grpcClient pb.GroupCacheClient) (err error) {
+		response, err = grpcClient.GetBatch(ctx, in)
 		return err
+	})
+	if status.Code(err) == codes.Unimplemented {
+		g.setUnsupported(methodGetBatch)
+		return errBatchUnsupported
 	}
-	defer cli.Close()
+	if err != nil {
+		return fmt.Errorf("reading response body:%v", err)
+	}
+	out.Items = response.Items
+	return nil
+}
+
+// supports 判断远程节点是否支持 method，没有记录时认为支持
+func (g *Client) supports(method string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return !time.Now().Before(g.unsupported[method])
+}
 
-	conn, err := registry.EtcdDial(cli, g.baseURL) //使用etcd客户端发现指定服务（g.baseURL）并建立连接（conn）。如果发现服务或建立连接失败，则返回错误。
+// setUnsupported 记录远程节点不支持 method，legacyRetry 之后再尝试
+func (g *Client) setUnsupported(method string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	log.Printf("[%s] peer does not support %s, fall back to the old RPC", g.addr, method)
+	if g.unsupported == nil {
+		g.unsupported = make(map[string]time.Time)
+	}
+	g.unsupported[method] = time.Now().Add(legacyRetry)
+}
+
+// Put 方法请求远程节点写入缓存值，缓存值超过 maxInlineValue 时不发送请求，直接返回 ErrValueTooLarge
+func (g *Client) Put(ctx context.Context, in *pb.PutRequest) error {
+	if err := checkValueSize(in.Key, in.Value); err != nil {
+		return err
+	}
+	return g.call(ctx, func(grpcClient pb.GroupCacheClient) error {
+		_, err := grpcClient.Put(ctx, in)
+		return err
+	})
+}
+
+// Remove 方法请求远程节点删除缓存值
+func (g *Client) Remove(ctx context.Context, in *pb.Request) error {
+	return g.call(ctx, func(grpcClient pb.GroupCacheClient) error {
+		_, err := grpcClient.Remove(ctx, in)
+		return err
+	})
+}
+
+// Invalidate 方法请求远程节点删除 hotCache 中的副本
+func (g *Client) Invalidate(ctx context.Context, in *pb.Request) error {
+	return g.call(ctx, func(grpcClient pb.GroupCacheClient) error {
+		_, err := grpcClient.Invalidate(ctx, in)
+		return err
+	})
+}
+
+// call 取出与远程节点的长连接，然后使用该连接执行一次 gRPC 请求
+func (g *Client) call(ctx context.Context, fn func(grpcClient pb.GroupCacheClient) error) error {
+	conn, err := g.acquire(ctx)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer g.release()
+	return fn(pb.NewGroupCacheClient(conn)) //创建一个 gRPC 客户端，用于向远程对等节点发送请求
+}
+
+// acquire 返回可用的长连接，连接不存在或已经关闭时重新建立。
+// 连接由后台协程在 g.mu 之外建立，同时到达的请求等待同一次连接，并在各自的 ctx 结束时返回，
+// 建立连接期间其他请求、Close 和空闲检查都不会被阻塞。
+// 建立连接失败后按指数退避，退避期间直接返回上一次的错误，避免每个请求都去连接一个不可用的节点。
+func (g *Client) acquire(ctx context.Context) (*grpc.ClientConn, error) {
+	for {
+		g.mu.Lock()
+		if g.closed {
+			g.mu.Unlock()
+			return nil, fmt.Errorf("client %s closed", g.addr)
+		}
+		if g.conn != nil && g.conn.GetState() == connectivity.Shutdown {
+			g.closeConnLocked()
+		}
+		if g.conn != nil {
+			conn := g.conn
+			g.inflight.Add(1)
+			g.lastUsed = time.Now()
+			g.mu.Unlock()
+			return conn, nil
+		}
+		if g.dialErr != nil && time.Now().Before(g.retryAt) {
+			err := g.dialErr
+			g.mu.Unlock()
+			return nil, err
+		}
+		if g.dialing == nil { //没有正在建立的连接，由后台协程建立
+			dialCtx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+			g.dialing, g.cancelDial = make(chan struct{}), cancel
+			go g.redial(dialCtx, g.dialing)
+		}
+		dialing := g.dialing
+		g.mu.Unlock()
+		select {
+		case <-dialing: //连接建立成功或失败，重新检查
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
 
-	grpcClient := pb.NewGroupCacheClient(conn)                               //创建一个 gRPC 客户端，用于向远程对等节点发送请求
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) //创建一个带有10秒超时时间的上下文，并使用该上下文发送 gRPC 请求到远程节点
-	defer cancel()
-	response, err := grpcClient.Get(ctx, in)
+// redial 建立连接并在 g.mu 内发布结果，然后关闭 done 唤醒等待的请求。
+// 建立连接期间 Client 被关闭时，新建立的连接会被直接关闭
+func (g *Client) redial(ctx context.Context, done chan struct{}) {
+	conn, cli, err := g.dialConn(ctx)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	defer close(done)
+	g.cancelDial()
+	g.dialing, g.cancelDial = nil, nil
 	if err != nil {
-		return fmt.Errorf("reading response body:%v", err)
+		g.failures++
+		g.dialErr = err
+		g.retryAt = time.Now().Add(dialBackoff(g.failures))
+		return
 	}
-	if err = proto.Unmarshal(response.GetValue(), out); err != nil {
-		return fmt.Errorf("decoding response body:%v", err)
+	if g.closed {
+		closeConn(conn, cli)
+		return
+	}
+	g.conn, g.etcdCli, g.dialErr, g.failures = conn, cli, nil, 0
+	if g.stop == nil {
+		g.stop = make(chan struct{})
+		go g.evictIdle(g.stop)
+	}
+}
+
+// load 返回正在进行的请求数量，用于有界负载模式。它在 Server.PickPeer 持有 s.mu 时被调用，因此不能获取 g.mu
+func (g *Client) load() int64 {
+	return g.inflight.Get()
+}
+
+// release 在请求结束后归还连接
+func (g *Client) release() {
+	g.mu.Lock()
+	g.inflight.Add(-1)
+	g.lastUsed = time.Now()
+	g.mu.Unlock()
+}
+
+// dialConn 建立与远程节点的连接，返回连接以及用于服务发现的etcd客户端（使用 g.dial 时为 nil），不访问 g 的连接状态
+func (g *Client) dialConn(ctx context.Context) (*grpc.ClientConn, *clientv3.Client, error) {
+	if g.dial != nil {
+		conn, err := g.dial(ctx)
+		return conn, nil, err
+	}
+	cli, err := g.registry.NewClient() // 创建一个etcd客户端，与连接一同保留
+	if err != nil {
+		return nil, nil, err
+	}
+	//使用etcd客户端发现远程节点的服务（<Prefix>/g.addr）并建立连接（conn）。连接断开后 gRPC 会按照退避策略自动重连。
+	conn, err := registry.EtcdDial(ctx, cli, g.registry, g.addr, grpc.WithTransportCredentials(g.creds), grpc.WithConnectParams(grpc.ConnectParams{
+		Backoff:           backoff.Config{BaseDelay: dialBaseDelay, Multiplier: 1.6, Jitter: 0.2, MaxDelay: dialMaxDelay},
+		MinConnectTimeout: 5 * time.Second,
+	}), grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMessageSize), grpc.MaxCallSendMsgSize(maxMessageSize)))
+	if err != nil {
+		cli.Close()
+		return nil, nil, err
+	}
+	return conn, cli, nil
+}
+
+// closeConnLocked 关闭长连接以及对应的etcd客户端，调用方需要持有 g.mu
+func (g *Client) closeConnLocked() {
+	closeConn(g.conn, g.etcdCli)
+	g.conn, g.etcdCli = nil, nil
+}
+
+// closeConn 关闭连接以及对应的etcd客户端，二者都可以为 nil
+func closeConn(conn *grpc.ClientConn, cli *clientv3.Client) {
+	if conn != nil {
+		conn.Close()
+	}
+	if cli != nil {
+		cli.Close()
+	}
+}
+
+// evictIdle 定期检查连接，关闭空闲时间超过 idleTimeout 的连接
+func (g *Client) evictIdle(stop chan struct{}) {
+	ticker := time.NewTicker(g.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			g.mu.Lock()
+			if g.conn != nil && g.inflight.Get() == 0 && time.Since(g.lastUsed) > g.idleTimeout {
+				log.Printf("[GeeCache] close idle connection to %s", g.addr)
+				g.closeConnLocked()
+			}
+			g.mu.Unlock()
+		}
+	}
+}
+
+// Close 关闭长连接并停止空闲检查，之后的请求都会返回错误
+func (g *Client) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	if g.stop != nil {
+		close(g.stop)
+	}
+	if g.cancelDial != nil { //中断正在建立的连接
+		g.cancelDial()
 	}
+	g.closeConnLocked()
 	return nil
 }
 
-// NewClient 创建一个远程节点客户端
-func NewClient(service string) *Client {
-	return &Client{baseURL: service}
+// dialBackoff 返回第 failures 次建立连接失败后的退避时间
+func dialBackoff(failures int) time.Duration {
+	delay := dialBaseDelay
+	for i := 1; i < failures && delay < dialMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > dialMaxDelay {
+		delay = dialMaxDelay
+	}
+	return delay
+}
+
+// ClientOption 用于在创建 Client 时修改默认配置
+type ClientOption func(*Client)
+
+// WithClientTLS 使与远程节点的连接使用 TLS，cfg 通常由 tlsutil.Config.ClientConfig 创建
+func WithClientTLS(cfg *tls.Config) ClientOption {
+	return func(g *Client) {
+		g.creds = credentials.NewTLS(cfg)
+	}
 }
 
-// 测试 Client 是否实现了 PeerGetter 接口
-var _ PeerGetter = (*Client)(nil)
+// WithClientRegistry 设置发现远程节点时访问etcd的配置，应当与远程节点注册时使用的配置相同
+func WithClientRegistry(cfg registry.Config) ClientOption {
+	return func(g *Client) {
+		g.registry = cfg
+	}
+}
+
+// NewClient 创建地址为 addr（ip:port）的远程节点的客户端，连接在第一次请求时建立，
+// 连接时通过etcd发现 <Prefix>/<addr> 服务
+func NewClient(addr string, opts ...ClientOption) *Client {
+	g := &Client{addr: addr, idleTimeout: defaultIdleTimeout, creds: insecure.NewCredentials()}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// 测试 Client 是否实现了 PeerGetter 和 BatchPeerGetter 接口
+var (
+	_ PeerGetter      = (*Client)(nil)
+	_ BatchPeerGetter = (*Client)(nil)
+)
 
 /*
 如何理解这个Server和Client。
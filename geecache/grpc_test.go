@@ -0,0 +1,854 @@
+package geecache
+
+import (
+	pb "Geecache/geecache/geecachepb"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"Geecache/geecache/jumphash"
+	"Geecache/geecache/registry"
+	"Geecache/geecache/registry/etcdtest"
+	"Geecache/geecache/rendezvous"
+	"Geecache/geecache/tlsutil"
+	"Geecache/geecache/tlsutil/tlstest"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// startTestServer 在随机端口启动一个不注册到etcd的 gRPC 服务，返回服务地址
+func startTestServer(tb testing.TB, opts ...ServerOption) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	svr, err := NewServer(lis.Addr().String(), opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	grpcServer := grpc.NewServer(grpc.Creds(svr.creds))
+	pb.RegisterGroupCacheServer(grpcServer, svr)
+	go grpcServer.Serve(lis)
+	tb.Cleanup(grpcServer.Stop)
+	return lis.Addr().String()
+}
+
+// dialDirect 绕过etcd直接连接服务地址
+func dialDirect(ctx context.Context, addr string) (*grpc.ClientConn, error) {
+	return grpc.DialContext(ctx, addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+}
+
+// newDirectClient 创建一个绕过etcd直接连接服务地址的 Client
+func newDirectClient(addr string, opts ...ClientOption) *Client {
+	client := NewClient(addr, opts...)
+	client.dial = func(ctx context.Context) (*grpc.ClientConn, error) {
+		return grpc.DialContext(ctx, addr, grpc.WithTransportCredentials(client.creds), grpc.WithBlock())
+	}
+	return client
+}
+
+// currentConn 返回 Client 当前持有的长连接
+func (g *Client) currentConn() *grpc.ClientConn {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.conn
+}
+
+func newPeerTestGroup(name string) *Group {
+	return NewGroup(name, 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}))
+}
+
+// 测试 Client 复用长连接，并在空闲超时后关闭连接
+func TestClientConnReuse(t *testing.T) {
+	newPeerTestGroup("peer-scores")
+	client := newDirectClient(startTestServer(t))
+	client.idleTimeout = 50 * time.Millisecond
+	defer client.Close()
+
+	ctx := context.Background()
+	req := &pb.Request{Group: "peer-scores", Key: "Tom"}
+	out := &pb.GetResponse{}
+	if err := client.Get(ctx, req, out); err != nil || string(out.Value) != "630" {
+		t.Fatalf("expect Tom=630, but got %s, %v", out.Value, err)
+	}
+	conn := client.currentConn()
+	if err := client.Get(ctx, req, out); err != nil || client.currentConn() != conn {
+		t.Fatalf("connection should be reused, err: %v", err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if client.currentConn() != nil {
+		t.Fatalf("idle connection should be closed")
+	}
+	if err := client.Get(ctx, req, out); err != nil {
+		t.Fatalf("client should redial after idle eviction, err: %v", err)
+	}
+
+	client.Close()
+	if err := client.Get(ctx, req, out); err == nil {
+		t.Fatalf("closed client should return error")
+	}
+}
+
+// 测试建立连接失败后进入退避，退避期间直接返回错误
+func TestClientDialBackoff(t *testing.T) {
+	dials := 0
+	client := NewClient("unreachable")
+	client.dial = func(ctx context.Context) (*grpc.ClientConn, error) {
+		dials++
+		return nil, context.DeadlineExceeded
+	}
+	defer client.Close()
+	for i := 0; i < 3; i++ {
+		if err := client.Get(context.Background(), &pb.Request{Group: "peer-scores", Key: "Tom"}, &pb.GetResponse{}); err == nil {
+			t.Fatalf("expect dial error")
+		}
+	}
+	if dials != 1 {
+		t.Fatalf("expect 1 dial during backoff, but got %d", dials)
+	}
+}
+
+// 测试建立连接时不持有锁：等待连接的请求按自己的 ctx 超时，load 和 Close 不被阻塞，Close 会中断正在建立的连接
+func TestClientDialUnlocked(t *testing.T) {
+	started := make(chan struct{})
+	client := NewClient("slow")
+	client.dial = func(ctx context.Context) (*grpc.ClientConn, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	req := &pb.Request{Group: "peer-scores", Key: "Tom"}
+	first := make(chan error, 1)
+	go func() {
+		first <- client.Get(context.Background(), req, &pb.GetResponse{})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("waiting request should time out with its own ctx, but got %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		client.load()
+		client.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("load and Close should not wait for dialing")
+	}
+	select {
+	case err := <-first:
+		if err == nil {
+			t.Fatalf("request should fail after Close")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Close should interrupt dialing")
+	}
+}
+
+// 测试连接池中有连接时节点重新注册（例如重启或更新权重），etcd的 resolver 收到地址更新后连接仍然可用
+func TestClientReregister(t *testing.T) {
+	newPeerTestGroup("peer-scores")
+	etcd := etcdtest.New()
+	cfg := registry.Config{Prefix: "reregister", Dial: etcd.Dial}
+	addr := startTestServer(t)
+	deregister := registerPeer(t, etcd, cfg, addr, 1)
+	client := NewClient(addr, WithClientRegistry(cfg))
+	defer client.Close()
+
+	ctx := context.Background()
+	req := &pb.Request{Group: "peer-scores", Key: "Tom"}
+	out := &pb.GetResponse{}
+	if err := client.Get(ctx, req, out); err != nil || string(out.Value) != "630" {
+		t.Fatalf("expect Tom=630, but got %s, %v", out.Value, err)
+	}
+	conn := client.currentConn()
+	defer registerPeer(t, etcd, cfg, addr, 2)() //在新的租约下重新写入同一个 key，resolver 会用新的地址列表更新连接
+	deregister()
+	time.Sleep(100 * time.Millisecond) //等待 resolver 处理更新
+	if err := client.Get(ctx, req, out); err != nil || string(out.Value) != "630" || client.currentConn() != conn {
+		t.Fatalf("connection should survive re-registration, but got %s, %v", out.Value, err)
+	}
+}
+
+// BenchmarkPeerGet 对比每次请求重新建立连接与复用长连接时，远程节点命中缓存的延迟
+func BenchmarkPeerGet(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	newPeerTestGroup("peer-bench")
+	addr := startTestServer(b)
+	ctx := context.Background()
+	req := &pb.Request{Group: "peer-bench", Key: "Tom"}
+
+	b.Run("dial-per-request", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			conn, err := dialDirect(ctx, addr)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err = pb.NewGroupCacheClient(conn).Get(ctx, req); err != nil {
+				b.Fatal(err)
+			}
+			conn.Close()
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		client := newDirectClient(addr)
+		defer client.Close()
+		for i := 0; i < b.N; i++ {
+			if err := client.Get(ctx, req, &pb.GetResponse{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// registerPeer 通过 registry.Register 把 addr 注册到进程内的etcd中，等到记录写入后返回注销函数。
+// 注销时 Register 退出并关闭etcd客户端，租约随之失效，节点的 key 被删除，与节点退出时相同
+func registerPeer(t *testing.T, etcd *etcdtest.Server, cfg registry.Config, addr string, weight int) (deregister func()) {
+	t.Helper()
+	stop, done := make(chan error), make(chan struct{})
+	go func() {
+		defer close(done)
+		registry.Register(cfg, addr, registry.Metadata{Weight: weight}, stop)
+	}()
+	want := fmt.Sprintf(`"weight":%d`, weight)
+	for i := 0; ; i++ {
+		if value, _ := etcd.Get(cfg.Key(addr)); strings.Contains(value, want) {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("%s is not registered with weight %d", addr, weight)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// watchServerPeers 让 svr 通过 registry.Watch 监听注册中心中的节点，直到测试结束
+func watchServerPeers(t *testing.T, svr *Server) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svr.watchPeers(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// peerClient 返回 Server 当前持有的地址为 addr 的节点的 Client
+func (s *Server) peerClient(addr string) *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clients[addr]
+}
+
+// owner 返回哈希环上 key 的拥有者
+func (s *Server) owner(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peers.Get(key)
+}
+
+// waitServerMembers 等待 Server 的集群节点变为 expect
+func waitServerMembers(t *testing.T, svr *Server, expect ...string) {
+	sort.Strings(expect)
+	deadline := time.Now().Add(time.Second)
+	for {
+		svr.mu.Lock()
+		var got []string
+		for addr := range svr.clients {
+			got = append(got, addr)
+		}
+		svr.mu.Unlock()
+		sort.Strings(got)
+		if reflect.DeepEqual(got, expect) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect members %v, but got %v", expect, got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// 测试 Server 根据注册中心的变化实时重建一致性哈希环
+func TestServerWatchPeers(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	etcd := etcdtest.New()
+	cfg := registry.Config{Dial: etcd.Dial}
+	deregisterSelf := registerPeer(t, etcd, cfg, "127.0.0.1:8001", 1)
+	deregister2 := registerPeer(t, etcd, cfg, "127.0.0.1:8002", 1)
+	svr, _ := NewServer("127.0.0.1:8001", WithRegistry(cfg))
+	svr.Set("127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003") //8003 没有注册，应当被移除
+	watchServerPeers(t, svr)
+
+	waitMembers := func(expect ...string) {
+		t.Helper()
+		waitServerMembers(t, svr, expect...)
+	}
+	waitMembers("127.0.0.1:8001", "127.0.0.1:8002")
+
+	defer registerPeer(t, etcd, cfg, "127.0.0.1:8004", 1)()
+	waitMembers("127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8004")
+
+	deregister2()
+	waitMembers("127.0.0.1:8001", "127.0.0.1:8004")
+	alive := svr.peerClient("127.0.0.1:8004")
+	for i := 0; i < 100; i++ {
+		if peer, ok := svr.PickPeer(strconv.Itoa(i)); ok && peer != alive {
+			t.Fatalf("key %d should not be routed to a dead node", i)
+		}
+	}
+
+	deregisterSelf() //自己始终属于集群
+	waitMembers("127.0.0.1:8001", "127.0.0.1:8004")
+}
+
+// 测试 Server 只发现 registry.Config 中的前缀下的节点，并把配置传给其他节点的客户端
+func TestServerRegistryPrefix(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	if _, err := NewServer("127.0.0.1:8001", WithRegistry(registry.Config{Prefix: "prod/geecache"})); err == nil {
+		t.Fatalf("prefix with / should be rejected")
+	}
+	etcd := etcdtest.New()
+	cfg := registry.Config{Prefix: "cluster-b", LeaseTTL: 10 * time.Second, Dial: etcd.Dial}
+	defer registerPeer(t, etcd, cfg, "127.0.0.1:8002", 1)()
+	other := cfg
+	other.Prefix = "cluster-bb" //以 cluster-b 开头的其他集群
+	defer registerPeer(t, etcd, other, "127.0.0.1:9002", 1)()
+	etcd.Put("cluster-b/127.0.0.1:9003", `{"Op":0,"Addr":"127.0.0.1:9003"}`) //旧版本的 key，etcd的 resolver 无法解析，忽略
+	svr, err := NewServer("127.0.0.1:8001", WithRegistry(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	watchServerPeers(t, svr)
+	waitServerMembers(t, svr, "127.0.0.1:8001", "127.0.0.1:8002")
+
+	client := svr.peerClient("127.0.0.1:8002")
+	if key := client.registry.Key(client.addr); key != "cluster-b/127.0.0.1:8002/node" {
+		t.Fatalf("client should discover cluster-b/127.0.0.1:8002/node, but got %s", key)
+	}
+	deregister3 := registerPeer(t, etcd, cfg, "127.0.0.1:8003", 1)
+	waitServerMembers(t, svr, "127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003")
+	deregister3()
+	waitServerMembers(t, svr, "127.0.0.1:8001", "127.0.0.1:8002")
+}
+
+// 测试 Server 使用注册中心中的节点权重构建一致性哈希环
+func TestServerWeightedPeers(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	etcd := etcdtest.New()
+	cfg := registry.Config{Dial: etcd.Dial}
+	defer registerPeer(t, etcd, cfg, "127.0.0.1:8002", 4)()
+	defer registerPeer(t, etcd, cfg, "127.0.0.1:8003", 0)() //没有权重信息的节点权重为 1
+	svr, _ := NewServer("127.0.0.1:8001", WithWeight(3), WithRegistry(cfg))
+	watchServerPeers(t, svr)
+	waitServerMembers(t, svr, "127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003")
+
+	counts := make(map[string]int)
+	const n = 50000
+	svr.mu.Lock()
+	for i := 0; i < n; i++ {
+		counts[svr.peers.Get("key"+strconv.Itoa(i))]++
+	}
+	svr.mu.Unlock()
+	weights := map[string]float64{"127.0.0.1:8001": 3, "127.0.0.1:8002": 4, "127.0.0.1:8003": 1}
+	for addr, weight := range weights {
+		if share := float64(counts[addr]) / n; share < weight/8-0.1 || share > weight/8+0.1 {
+			t.Errorf("%s with weight %v should own %.3f of keys, but owns %.3f", addr, weight, weight/8, share)
+		}
+	}
+}
+
+func TestServerPlacement(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	if _, err := NewServer("127.0.0.1:8001", WithPlacement(nil)); err == nil {
+		t.Fatalf("NewServer should fail without placement")
+	}
+	addrs := []string{"127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003"}
+	svr, err := NewServer(addrs[0], WithPlacement(func() Placement { return rendezvous.New(nil) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.Set(addrs...)
+	expect := rendezvous.New(nil)
+	expect.Add(addrs...)
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		peer, ok := svr.PickPeer(key)
+		if owner := expect.Get(key); owner == addrs[0] {
+			if ok {
+				t.Fatalf("%s should be owned by self", key)
+			}
+		} else if !ok || peer != svr.peerClient(owner) {
+			t.Fatalf("%s should be owned by %s", key, owner)
+		}
+	}
+}
+
+func TestServerBoundedLoad(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	if _, err := NewServer("127.0.0.1:8001", WithBoundedLoad(0.5)); err == nil {
+		t.Fatalf("NewServer should reject load factor less than 1")
+	}
+	jump := WithPlacement(func() Placement { return jumphash.New(nil) })
+	if _, err := NewServer("127.0.0.1:8001", jump, WithBoundedLoad(1.25)); err == nil {
+		t.Fatalf("NewServer should reject placement without bounded load support")
+	}
+	addrs := []string{"127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003"}
+	svr, err := NewServer(addrs[0], WithBoundedLoad(1.25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.Set(addrs...)
+	var key string
+	for i := 0; ; i++ {
+		key = "key" + strconv.Itoa(i)
+		if svr.owner(key) == addrs[1] {
+			break
+		}
+	}
+	busy := svr.peerClient(addrs[1])
+	busy.inflight.Add(10) //模拟发往 8002 的请求积压
+	busy.mu.Lock()        //PickPeer 读取负载时不应该等待 Client 的锁，例如该节点正在建立连接时
+	picked := make(chan PeerGetter, 1)
+	go func() {
+		peer, _ := svr.PickPeer(key)
+		picked <- peer
+	}()
+	select {
+	case peer := <-picked:
+		if peer == busy {
+			t.Fatalf("%s should not be picked when it is overloaded", addrs[1])
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("PickPeer should not wait for the client lock")
+	}
+	busy.mu.Unlock()
+	busy.inflight.Add(-10)
+	if peer, ok := svr.PickPeer(key); !ok || peer != busy {
+		t.Fatalf("%s should be picked again after its load drops", addrs[1])
+	}
+}
+
+func TestServerPickPeers(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	addrs := []string{"127.0.0.1:8001", "127.0.0.1:8002", "127.0.0.1:8003"}
+	svr, _ := NewServer(addrs[0])
+	svr.Set(addrs...)
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		var expect []PeerGetter
+		for _, addr := range svr.peers.GetN(key, 2) {
+			if addr == addrs[0] {
+				break
+			}
+			expect = append(expect, svr.peerClient(addr))
+		}
+		peers := svr.PickPeers(key, 2)
+		if len(peers) != len(expect) {
+			t.Fatalf("PickPeers(%s, 2) should return %d peers, but got %d", key, len(expect), len(peers))
+		}
+		for j := range peers {
+			if peers[j] != expect[j] {
+				t.Fatalf("PickPeers(%s, 2) returned peers in wrong order", key)
+			}
+		}
+		if peer, ok := svr.PickPeer(key); ok != (len(peers) > 0) || ok && peer != peers[0] {
+			t.Fatalf("the first of PickPeers(%s, 2) should be PickPeer(%s)", key, key)
+		}
+	}
+}
+
+// 测试远程节点通过 NotFound 字段返回不存在的 key，而不是返回错误
+func TestClientNotFound(t *testing.T) {
+	NewGroup("peer-missing-scores", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}))
+	client := newDirectClient(startTestServer(t))
+	defer client.Close()
+	out := &pb.GetResponse{}
+	if err := client.Get(context.Background(), &pb.Request{Group: "peer-missing-scores", Key: "Tom"}, out); err != nil || !out.NotFound {
+		t.Fatalf("expect not found without error, but got %v, %v", out.NotFound, err)
+	}
+}
+
+// 测试第一版的 Get 对不存在的 key 返回 codes.NotFound，按照旧版本客户端的方式解码时不会得到空的缓存值
+func TestServerGetV1NotFound(t *testing.T) {
+	NewGroup("peer-v1-scores", 2<<10, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}))
+	conn, err := grpc.Dial(startTestServer(t), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	legacyGet := func(key string) (*pb.Response, error) { //与旧版本的 Client.Get 相同：请求失败或者解码失败时返回错误
+		response, err := pb.NewGroupCacheClient(conn).Get(context.Background(), &pb.Request{Group: "peer-v1-scores", Key: key})
+		if err != nil {
+			return nil, err
+		}
+		out := &pb.Response{}
+		if err := proto.Unmarshal(response.GetValue(), out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+	if out, err := legacyGet("Tom"); err != nil || string(out.Value) != "630" {
+		t.Fatalf("expect Tom=630, but got %v, %v", out, err)
+	}
+	if out, err := legacyGet("unknown"); status.Code(err) != codes.NotFound {
+		t.Fatalf("expect codes.NotFound, but got %v, %v", out, err)
+	}
+}
+
+// 测试拥有者的过期时间随响应传给其他节点
+func TestClientExpire(t *testing.T) {
+	expire := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	NewGroupCtx("peer-expire-scores2", 2<<10, "lru", ExpiringGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			return []byte(db[key]), expire, nil
+		}))
+	client := newDirectClient(startTestServer(t))
+	defer client.Close()
+	out := &pb.GetResponse{}
+	if err := client.Get(context.Background(), &pb.Request{Group: "peer-expire-scores2", Key: "Tom"}, out); err != nil || out.Expire != expire.UnixMilli() {
+		t.Fatalf("expect expire %d, but got %d, %v", expire.UnixMilli(), out.Expire, err)
+	}
+	if out.Version == 0 || out.Version > time.Now().UnixNano() {
+		t.Fatalf("version should be the load time on the owner, but got %d", out.Version)
+	}
+}
+
+// legacyServer 模拟还没有升级、只支持第一版 Get 的节点
+type legacyServer struct {
+	pb.UnimplementedGroupCacheServer
+	svr    *Server
+	getV2s AtomicInt
+}
+
+func (s *legacyServer) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	return s.svr.Get(ctx, in)
+}
+
+func (s *legacyServer) GetV2(ctx context.Context, in *pb.Request) (*pb.GetResponse, error) {
+	s.getV2s.Add(1)
+	return s.UnimplementedGroupCacheServer.GetV2(ctx, in)
+}
+
+// 远程节点不支持 GetV2 时回退到第一版的 Get，并在一段时间内不再尝试 GetV2
+func TestClientLegacyFallback(t *testing.T) {
+	expire := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	NewGroupCtx("legacy-scores", 2<<10, "lru", ExpiringGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			if key == "unknown" {
+				return nil, time.Time{}, notFound(key)
+			}
+			return []byte(db[key]), expire, nil
+		}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr, _ := NewServer(lis.Addr().String())
+	legacy := &legacyServer{svr: svr}
+	grpcServer := grpc.NewServer()
+	pb.RegisterGroupCacheServer(grpcServer, legacy)
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	client := newDirectClient(lis.Addr().String())
+	defer client.Close()
+	for i := 0; i < 3; i++ {
+		out := &pb.GetResponse{}
+		if err := client.Get(context.Background(), &pb.Request{Group: "legacy-scores", Key: "Tom"}, out); err != nil || string(out.Value) != "630" || out.Expire != expire.UnixMilli() {
+			t.Fatalf("expect Tom=630 from the legacy peer, but got %s, %d, %v", out.Value, out.Expire, err)
+		}
+	}
+	out := &pb.GetResponse{}
+	if err := client.Get(context.Background(), &pb.Request{Group: "legacy-scores", Key: "unknown"}, out); err != nil || !out.NotFound {
+		t.Fatalf("expect not found from the legacy peer, but got %v, %v", out.NotFound, err)
+	}
+	if legacy.getV2s.Get() != 1 {
+		t.Fatalf("GetV2 should be tried once, but tried %d times", legacy.getV2s.Get())
+	}
+	for i := 0; i < 2; i++ {
+		if err := client.GetBatch(context.Background(), &pb.BatchRequest{Group: "legacy-scores", Keys: []string{"Tom"}}, &pb.BatchResponse{}); err != errBatchUnsupported {
+			t.Fatalf("expect errBatchUnsupported, but got %v", err)
+		}
+	}
+
+	client.mu.Lock()
+	client.unsupported[methodGetV2] = time.Now() //模拟 legacyRetry 已经过去，节点可能已经升级
+	client.mu.Unlock()
+	client.Get(context.Background(), &pb.Request{Group: "legacy-scores", Key: "Tom"}, &pb.GetResponse{})
+	if legacy.getV2s.Get() != 2 {
+		t.Fatalf("GetV2 should be retried after legacyRetry, but tried %d times", legacy.getV2s.Get())
+	}
+}
+
+func TestServerGetBatch(t *testing.T) {
+	getter := &batchGetter{}
+	if _, err := NewGroupWithOptions("peer-batch-scores", getter); err != nil {
+		t.Fatal(err)
+	}
+	client := newDirectClient(startTestServer(t))
+	defer client.Close()
+	out := &pb.BatchResponse{}
+	keys := []string{"Tom", "unknown", "Jack", "Tom"}
+	if err := client.GetBatch(context.Background(), &pb.BatchRequest{Group: "peer-batch-scores", Keys: keys}, out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Items) != len(keys) {
+		t.Fatalf("expect %d items, but got %d", len(keys), len(out.Items))
+	}
+	for i, expect := range []string{"630", "", "589", "630"} {
+		item := out.Items[i]
+		if item.Error != "" || string(item.Response.Value) != expect || item.Response.NotFound != (expect == "") || (expect != "" && item.Response.Expire == 0) {
+			t.Fatalf("unexpected item %d: %v", i, item)
+		}
+	}
+	if !reflect.DeepEqual([][]string{{"Tom", "unknown", "Jack"}}, getter.batches) {
+		t.Fatalf("misses should be loaded in one batch, but got %v", getter.batches)
+	}
+	if err := client.GetBatch(context.Background(), &pb.BatchRequest{Group: "unknown-group", Keys: keys}, &pb.BatchResponse{}); err == nil {
+		t.Fatalf("unknown group should fail")
+	}
+}
+
+// 写入的缓存值最多为 maxInlineValue，更大的值在发送之前被拒绝
+func TestClientPutTooLarge(t *testing.T) {
+	g := NewGroup("peer-put-scores", 32<<20, "lru", GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, notFound(key)
+		}))
+	client := newDirectClient(startTestServer(t))
+	defer client.Close()
+	value := make([]byte, maxInlineValue)
+	if err := client.Put(context.Background(), &pb.PutRequest{Group: "peer-put-scores", Key: "max", Value: value}); err != nil {
+		t.Fatalf("value of maxInlineValue bytes should fit in one message, but got %v", err)
+	}
+	if v, ok := g.mainCache.get("max"); !ok || v.Len() != maxInlineValue {
+		t.Fatalf("value should be written to the owner")
+	}
+	large := make([]byte, maxInlineValue+1)
+	if err := client.Put(context.Background(), &pb.PutRequest{Group: "peer-put-scores", Key: "large", Value: large}); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("expect ErrValueTooLarge, but got %v", err)
+	}
+	if err := g.Set("large", large, 0); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("expect ErrValueTooLarge from Set, but got %v", err)
+	}
+	if _, ok := g.mainCache.get("large"); ok {
+		t.Fatalf("too large value should not be written")
+	}
+}
+
+// 测试超过 gRPC 默认 4MB 消息限制的缓存值通过 GetStream 分块获取
+func TestClientGetStream(t *testing.T) {
+	large := make([]byte, 5<<20+123)
+	for i := range large {
+		large[i] = byte(i % 251)
+	}
+	medium := large[:3<<20] //超过 1MB 但可以放在一个消息中
+	expire := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	g := NewGroupCtx("peer-large-values", 32<<20, "lru", ExpiringGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			switch key {
+			case "large":
+				return large, expire, nil
+			case "medium", "medium2":
+				return medium, expire, nil
+			}
+			return []byte(db[key]), expire, nil
+		}))
+	client := newDirectClient(startTestServer(t))
+	defer client.Close()
+	out := &pb.GetResponse{}
+	if err := client.Get(context.Background(), &pb.Request{Group: "peer-large-values", Key: "large"}, out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Value, large) || out.Expire != expire.UnixMilli() || out.Version == 0 {
+		t.Fatalf("unexpected large value: %d bytes, expire %d, version %d", len(out.Value), out.Expire, out.Version)
+	}
+
+	batch := &pb.BatchResponse{}
+	if err := client.GetBatch(context.Background(), &pb.BatchRequest{Group: "peer-large-values", Keys: []string{"Tom", "large"}}, batch); err != nil {
+		t.Fatal(err)
+	}
+	if item := batch.Items[0]; item.TooLarge || string(item.Response.Value) != "630" {
+		t.Fatalf("small value should be inlined, but got %v", item)
+	}
+	if item := batch.Items[1]; !item.TooLarge || len(item.Response.GetValue()) != 0 {
+		t.Fatalf("large value should not be inlined, but got %d bytes", len(item.Response.GetValue()))
+	}
+	batch = &pb.BatchResponse{}
+	if err := client.GetBatch(context.Background(), &pb.BatchRequest{Group: "peer-large-values", Keys: []string{"medium", "medium2"}}, batch); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(batch.Items[0].Response.GetValue(), medium) || !batch.Items[1].TooLarge {
+		t.Fatalf("only the first medium value fits in one message")
+	}
+
+	client.setUnsupported(methodGetStream) //放得下一个消息的缓存值直接通过 GetV2 获取，不需要 GetStream
+	out = &pb.GetResponse{}
+	if err := client.Get(context.Background(), &pb.Request{Group: "peer-large-values", Key: "medium"}, out); err != nil || !bytes.Equal(out.Value, medium) {
+		t.Fatalf("medium value should be inlined, but got %d bytes, %v", len(out.Value), err)
+	}
+
+	view, err := g.Get("large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read, err := io.ReadAll(view.Reader()); err != nil || !bytes.Equal(read, large) {
+		t.Fatalf("Reader should return the whole value, but got %d bytes, %v", len(read), err)
+	}
+}
+
+// streamServer 模拟缓存值太大、GetStream 中数据被损坏或截断的节点，chunks 为 nil 时模拟不支持 GetStream 的节点
+type streamServer struct {
+	pb.UnimplementedGroupCacheServer
+	chunks []*pb.Chunk
+}
+
+func (s *streamServer) GetV2(ctx context.Context, in *pb.Request) (*pb.GetResponse, error) {
+	return nil, status.Error(codes.ResourceExhausted, "value is too large")
+}
+
+func (s *streamServer) GetStream(in *pb.Request, stream pb.GroupCache_GetStreamServer) error {
+	if s.chunks == nil {
+		return s.UnimplementedGroupCacheServer.GetStream(in, stream)
+	}
+	for _, chunk := range s.chunks {
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startStreamServer 在随机端口启动一个 streamServer，返回服务地址
+func startStreamServer(tb testing.TB, chunks []*pb.Chunk) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterGroupCacheServer(grpcServer, &streamServer{chunks: chunks})
+	go grpcServer.Serve(lis)
+	tb.Cleanup(grpcServer.Stop)
+	return lis.Addr().String()
+}
+
+// 测试客户端拒绝校验和或长度不匹配的缓存值
+func TestClientStreamCorrupted(t *testing.T) {
+	value := []byte("0123456789")
+	checksum := crc32.ChecksumIEEE(value)
+	cases := []struct {
+		name   string
+		chunks []*pb.Chunk
+		ok     bool
+	}{
+		{"ok", []*pb.Chunk{{Data: value[:6], Size: 10, Checksum: checksum}, {Data: value[6:]}}, true},
+		{"checksum", []*pb.Chunk{{Data: value[:6], Size: 10, Checksum: checksum + 1}, {Data: value[6:]}}, false},
+		{"truncated", []*pb.Chunk{{Data: value[:6], Size: 10, Checksum: checksum}}, false},
+		{"too long", []*pb.Chunk{{Data: value[:6], Size: 10, Checksum: checksum}, {Data: value}}, false},
+		{"huge size", []*pb.Chunk{{Data: value, Size: 1 << 50, Checksum: checksum}}, false}, //不能按照声明的长度分配内存
+	}
+	for _, c := range cases {
+		client := newDirectClient(startStreamServer(t, c.chunks))
+		out := &pb.GetResponse{}
+		err := client.Get(context.Background(), &pb.Request{Group: "scores", Key: "Tom"}, out)
+		client.Close()
+		if c.ok && (err != nil || !bytes.Equal(out.Value, value)) {
+			t.Fatalf("%s: expect %s, but got %s, %v", c.name, value, out.Value, err)
+		}
+		if !c.ok && err == nil {
+			t.Fatalf("%s: corrupted value should be rejected, but got %s", c.name, out.Value)
+		}
+	}
+
+	client := newDirectClient(startStreamServer(t, nil))
+	defer client.Close()
+	if err := client.Get(context.Background(), &pb.Request{Group: "scores", Key: "Tom"}, &pb.GetResponse{}); err == nil {
+		t.Fatalf("expect an error from the peer without GetStream")
+	}
+	if client.supports(methodGetStream) {
+		t.Fatalf("GetStream should not be tried again within legacyRetry")
+	}
+}
+
+// 测试开启双向 TLS 后，只有出示了可信证书的客户端可以访问节点
+func TestServerTLS(t *testing.T) {
+	newPeerTestGroup("tls-scores")
+	ca := tlstest.NewCA(t)
+	_, cert, key := ca.Issue(t, "node", "127.0.0.1")
+	cfg := tlsutil.Config{CertFile: cert, KeyFile: key, CAFile: ca.CertFile}
+	addr := startTestServer(t, WithTLS(cfg))
+
+	get := func(client *Client) (*pb.GetResponse, error) {
+		defer client.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		out := &pb.GetResponse{}
+		return out, client.Get(ctx, &pb.Request{Group: "tls-scores", Key: "Tom"}, out)
+	}
+	svr, err := NewServer("127.0.0.1:0", WithTLS(cfg)) //其他节点使用的客户端选项
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := get(newDirectClient(addr, svr.clientOpts...)); err != nil || string(out.Value) != "630" {
+		t.Fatalf("expect Tom=630 over mutual TLS, but got %s, %v", out.Value, err)
+	}
+	if _, err := get(newDirectClient(addr)); err == nil {
+		t.Fatalf("plaintext client should be rejected")
+	}
+	anonymous, _ := tlsutil.Config{CAFile: ca.CertFile}.ClientConfig()
+	if _, err := get(newDirectClient(addr, WithClientTLS(anonymous))); err == nil {
+		t.Fatalf("client without certificate should be rejected")
+	}
+	if _, err := NewServer("127.0.0.1:0", WithTLS(tlsutil.Config{CertFile: cert})); err == nil {
+		t.Fatalf("invalid TLS config should be rejected")
+	}
+}
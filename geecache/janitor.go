@@ -0,0 +1,70 @@
+package geecache
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultJanitorBatch 是 janitor 每次从一个缓存中最多清理的过期记录数量，避免长时间持有缓存的锁
+const defaultJanitorBatch = 256
+
+// Expirer 是可以主动清理过期记录的 Cache。Cache 默认只在 Get 时检查过期时间，
+// 实现了 Expirer 的淘汰算法可以由 janitor 在后台周期性地清理不再被访问的过期记录。
+// RemoveExpired 移除最多 limit 条已经过期的记录并返回移除的数量，被移除的记录同样需要调用 onEvicted。
+type Expirer interface {
+	RemoveExpired(limit int) int
+}
+
+/*
+janitor 是后台清理过期记录的协程：
+interval：清理的周期；
+batch：每个周期从每个缓存中最多清理的记录数量，过期记录很多时分摊到多个周期完成；
+caches：需要清理的缓存，没有实现 Expirer 的缓存会被跳过；
+stop、done：通知协程退出以及协程已经退出。
+*/
+type janitor struct {
+	interval time.Duration
+	batch    int
+	caches   []*syncCache
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// startJanitor 启动一个每隔 interval 清理一次 caches 的 janitor
+func startJanitor(interval time.Duration, batch int, caches ...*syncCache) *janitor {
+	j := &janitor{
+		interval: interval,
+		batch:    batch,
+		caches:   caches,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go j.run()
+	return j
+}
+
+// run 周期性地清理过期记录，直到 close 被调用
+func (j *janitor) run() {
+	defer close(j.done)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, c := range j.caches {
+				c.removeExpired(j.batch)
+			}
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// close 通知 janitor 退出并等待正在进行的清理完成，可以重复调用
+func (j *janitor) close() {
+	j.once.Do(func() {
+		close(j.stop)
+	})
+	<-j.done
+}
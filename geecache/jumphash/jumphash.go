@@ -0,0 +1,102 @@
+package jumphash
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+type Hash func(data []byte) uint64 //定义了函数类型 Hash，允许替换成自定义的 Hash 函数，默认为 64 位的 FNV-1a 算法。
+
+/*
+JumpHash 实现了 Google 提出的跳跃一致性哈希（Jump Consistent Hash）：
+不需要虚拟节点和额外的内存，只用 O(ln n) 的计算就能把 key 均匀地映射到 [0, n) 中的一个桶。
+桶的数量从 n 增加到 n+1 时，只有 1/(n+1) 的 key 会移动到新的桶。
+这个性质只对在末尾增删桶成立，而这里的节点按名称排序后依次对应各个桶，保证所有机器得到相同的映射，
+所以在中间加入或删除节点时会有更多的 key 移动，适合节点很少变化的集群。
+hash：哈希函数；
+nodes：所有节点的名称，按名称排序，下标即桶的编号。
+*/
+type JumpHash struct {
+	hash  Hash
+	nodes []string
+}
+
+// New 函数通过传入的哈希函数fn，返回一个 JumpHash 结构体。
+func New(fn Hash) *JumpHash {
+	j := &JumpHash{hash: fn}
+	if j.hash == nil {
+		j.hash = fnv64a
+	}
+	return j
+}
+
+// Add 函数添加 0 或多个节点，已经存在的节点会被忽略。
+func (j *JumpHash) Add(nodes ...string) {
+	for _, node := range nodes {
+		idx := sort.SearchStrings(j.nodes, node)
+		if idx < len(j.nodes) && j.nodes[idx] == node {
+			continue
+		}
+		j.nodes = append(j.nodes, "")
+		copy(j.nodes[idx+1:], j.nodes[idx:])
+		j.nodes[idx] = node
+	}
+}
+
+// Remove 函数删除传入的节点，不存在的节点会被忽略。
+func (j *JumpHash) Remove(nodes ...string) {
+	for _, node := range nodes {
+		idx := sort.SearchStrings(j.nodes, node)
+		if idx < len(j.nodes) && j.nodes[idx] == node {
+			j.nodes = append(j.nodes[:idx], j.nodes[idx+1:]...)
+		}
+	}
+}
+
+// Members 函数返回当前所有节点的名称，按名称排序。
+func (j *JumpHash) Members() []string {
+	return append([]string(nil), j.nodes...)
+}
+
+// Get 函数返回 key 所在的桶对应的节点，没有节点时返回空字符串。
+func (j *JumpHash) Get(key string) string {
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	return j.nodes[Jump(j.hash([]byte(key)), len(j.nodes))]
+}
+
+// GetN 函数从 key 所在的桶开始依次返回 n 个节点，第一个与 Get 的结果相同。节点数量不足 n 时返回所有节点。
+func (j *JumpHash) GetN(key string, n int) []string {
+	if n <= 0 || len(j.nodes) == 0 {
+		return nil
+	}
+	if n > len(j.nodes) {
+		n = len(j.nodes)
+	}
+	b := Jump(j.hash([]byte(key)), len(j.nodes))
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = j.nodes[(b+i)%len(j.nodes)]
+	}
+	return nodes
+}
+
+// Jump 函数把 key 映射到 [0, buckets) 中的一个桶，算法来自论文 A Fast, Minimal Memory, Consistent Hash Algorithm。
+// 每一轮用线性同余生成器产生伪随机数，决定 key 下一次"跳"到哪个桶，直到跳出桶的范围。
+func Jump(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// fnv64a 函数是默认的哈希函数。
+func fnv64a(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
@@ -0,0 +1,77 @@
+package jumphash
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestJump(t *testing.T) {
+	// 桶的数量从 n 增加到 n+1 时，key 要么留在原来的桶，要么移动到新的桶 n
+	for key := uint64(0); key < 1000; key++ {
+		prev := Jump(key, 1)
+		if prev != 0 {
+			t.Fatalf("Jump(%d, 1) should be 0, but got %d", key, prev)
+		}
+		for n := 2; n <= 20; n++ {
+			b := Jump(key, n)
+			if b != prev && b != n-1 {
+				t.Fatalf("Jump(%d, %d) = %d, should be %d or %d", key, n, b, prev, n-1)
+			}
+			prev = b
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	j := New(nil)
+	if j.Get("key") != "" {
+		t.Fatalf("empty JumpHash should return empty node")
+	}
+	j.Add("c", "a", "b", "a")
+	if members := j.Members(); !reflect.DeepEqual(members, []string{"a", "b", "c"}) {
+		t.Fatalf("Members should be [a b c], but got %v", members)
+	}
+	count := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		count[j.Get(strconv.Itoa(i))]++
+	}
+	for _, node := range j.Members() {
+		if count[node] < 800 || count[node] > 1200 {
+			t.Fatalf("keys should be evenly distributed, but got %v", count)
+		}
+	}
+	// 在末尾添加节点时，key 要么不动，要么移动到新节点
+	owners := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = j.Get(key)
+	}
+	j.Add("d")
+	for key, owner := range owners {
+		if now := j.Get(key); now != owner && now != "d" {
+			t.Fatalf("key %s should move to d or stay on %s, but got %s", key, owner, now)
+		}
+	}
+	j.Remove("d", "unknown")
+	for key, owner := range owners {
+		if now := j.Get(key); now != owner {
+			t.Fatalf("key %s should go back to %s, but got %s", key, owner, now)
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	j := New(nil)
+	j.Add("a", "b", "c")
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		nodes := j.GetN(key, 2)
+		if len(nodes) != 2 || nodes[0] != j.Get(key) || nodes[0] == nodes[1] {
+			t.Fatalf("GetN(%s, 2) = %v, first should be %s", key, nodes, j.Get(key))
+		}
+	}
+	if nodes := j.GetN("key", 5); len(nodes) != 3 {
+		t.Fatalf("GetN should return all 3 nodes, but got %v", nodes)
+	}
+}
@@ -2,6 +2,7 @@ package lfu
 
 import (
 	"container/heap"
+	"container/list"
 	"log"
 	"time"
 )
@@ -10,18 +11,23 @@ import (
 LFUCache 定义了一个结构体，用来实现lfu缓存淘汰算法
 maxBytes：最大存储容量
 nBytes：已占用的容量
-heap：使用一个 heap 来管理缓存项，heap 中的元素按照频率排序(heap实现了一个最小堆，即堆顶元素是最小值)
-cache：map，键是字符串，值是堆中对应节点的指针
+freqs：频率桶组成的双向链表，按访问频率从小到大排列，每个桶保存访问频率相同的记录，
+桶内是一个 LRU 链表，最近访问的记录在最前面。访问记录时把它移动到频率加 1 的桶，淘汰时取第一个桶的最后一条记录，
+即频率最低的记录中最久未使用的一条，Get、Add 和淘汰的时间复杂度都是 O(1)
+cache：map，键是字符串，值是对应的记录
 OnEvicted：是某条记录被移除时的回调函数，可以为 nil
-defaultTTL：记录在缓存中的默认过期时间
+decayInterval、lastDecay：频率衰减的周期和上一次衰减的时间，见 SetDecay
+expiry：按过期时间排列的最小堆，堆顶是最早过期的记录，用于淘汰时优先移除已过期的记录以及 RemoveExpired 主动清理
 */
 type LFUCache struct {
-	maxBytes   int64
-	nBytes     int64
-	heap       *entryHeap
-	cache      map[string]*entry
-	OnEvicted  func(key string, value Value)
-	defaultTTL time.Duration
+	maxBytes      int64
+	nBytes        int64
+	freqs         *list.List
+	cache         map[string]*entry
+	OnEvicted     func(key string, value Value)
+	decayInterval time.Duration
+	lastDecay     time.Time
+	expiry        expiryHeap
 }
 
 type Value interface {
@@ -31,103 +37,107 @@ type Value interface {
 type entry struct {
 	key    string
 	value  Value
-	freq   int       // 记录访问频率
-	index  int       // 在堆中的索引，用于快速定位
-	expire time.Time //节点的过期时间
+	freq   int           // 记录访问频率
+	bucket *list.Element // 所在的频率桶在 freqs 中的节点
+	elem   *list.Element // 在频率桶的链表中的节点，用于 O(1) 删除
+	expire time.Time     //节点的过期时间
+	index  int           //在 expiry 堆中的索引，用于快速定位
 }
 
-// entryHeap 实现了 heap.Interface 接口，用于对 entry 进行堆排序,实现最小堆
-type entryHeap []*entry
-
-// Len 函数用于返回entryHeap的长度
-func (h entryHeap) Len() int {
-	return len(h)
-}
-
-// Less 函数实现最小堆的排序
-func (h entryHeap) Less(i, j int) bool {
-	//小于号是因为我们需要一个最小堆
-	return h[i].freq < h[j].freq
-}
-
-// Swap 函数交换缓存项，包括在堆中的索引
-func (h entryHeap) Swap(i, j int) {
-	h[i], h[j] = h[j], h[i]
-	h[i].index = i
-	h[j].index = j
-}
-
-// Push 函数用于插入一个缓存项
-func (h *entryHeap) Push(x interface{}) {
-	entry := x.(*entry)
-	entry.index = len(*h)
-	*h = append(*h, entry)
-}
-
-// Pop 函数用于删除一个缓存项
-func (h *entryHeap) Pop() interface{} {
-	old := *h
-	n := len(old)
-	entry := old[n-1]
-	entry.index = -1 // for safety
-	*h = old[0 : n-1]
-	return entry
+// bucket 是访问频率相同的记录组成的频率桶
+type bucket struct {
+	freq  int
+	items *list.List
 }
 
-// New 函数通过传入maxBytes,onEvicted,defaultTTL这些参数，返回一个LFUCache结构体。
-func New(maxBytes int64, onEvicted func(string, Value), defaultTTL time.Duration) *LFUCache {
+// New 函数通过传入maxBytes,onEvicted这些参数，返回一个LFUCache结构体。
+func New(maxBytes int64, onEvicted func(string, Value)) *LFUCache {
 	return &LFUCache{
-		maxBytes:   maxBytes,
-		heap:       &entryHeap{},
-		cache:      make(map[string]*entry),
-		OnEvicted:  onEvicted,
-		defaultTTL: defaultTTL,
+		maxBytes:  maxBytes,
+		freqs:     list.New(),
+		cache:     make(map[string]*entry),
+		OnEvicted: onEvicted,
 	}
 }
 
-// Get 函数用于根据键获取缓存中的值。如果键存在，则将对应的节点的freq频率增加、调用Fix函数维持堆的性质，并返回对应的值和 true；如果键不存在或者键已经过期，则返回零值和 false。
+// SetDecay 设置频率衰减的周期：每经过 interval，所有记录的访问频率减半（向上取整，最小为 1），
+// 使过去的热点逐渐冷却，不会因为历史上积累的高频率永远留在缓存中。衰减在 Get 和 Add 时顺带检查，不需要后台协程。
+// interval 小于等于 0 时关闭衰减，默认关闭。
+func (c *LFUCache) SetDecay(interval time.Duration) {
+	c.decayInterval = interval
+	c.lastDecay = time.Now()
+}
+
+// Get 函数用于根据键获取缓存中的值。如果键存在，则将对应的节点移动到频率加 1 的桶，并返回对应的值和 true；如果键不存在或者键已经过期，则返回零值和 false。
 func (c *LFUCache) Get(key string) (value Value, ok bool) {
+	now := time.Now()
+	c.maybeDecay(now)
 	if ele, ok := c.cache[key]; ok {
-		if ele.expire.Before(time.Now()) {
+		if ele.expire.Before(now) {
 			c.removeElement(ele)
 			log.Printf("The LFUcache key—%s has expired", key)
 			return nil, false
 		}
-		ele.freq++
-		heap.Fix(c.heap, ele.index)
-		//Fix 方法用于在索引 index 处的元素值发生变化后重新确立堆的顺序。在索引 index 的元素值发生改变后，调用 Fix 方法可以保持堆的性质。
-		//Fix 方法的时间复杂度是 O(log n)，其中 n = h.Len() 表示堆中元素的数量。
+		c.increment(ele)
 		return ele.value, true
 	}
 	return
 }
 
-// RemoveOldest 函数删除频率最低的缓存项。
+// RemoveOldest 函数删除一个缓存项：最早过期的缓存项已经过期时优先删除它，
+// 否则删除频率最低的缓存项，频率相同时删除最久未使用的缓存项。
 func (c *LFUCache) RemoveOldest() {
-	entry := heap.Pop(c.heap).(*entry)
-	delete(c.cache, entry.key)
-	c.nBytes -= int64(len(entry.key)) + int64(entry.value.Len())
-	if c.OnEvicted != nil {
-		c.OnEvicted(entry.key, entry.value)
+	if len(c.expiry) > 0 && c.expiry[0].expire.Before(time.Now()) {
+		c.removeElement(c.expiry[0])
+		return
+	}
+	if front := c.freqs.Front(); front != nil {
+		c.removeElement(front.Value.(*bucket).items.Back().Value.(*entry))
+	}
+}
+
+// RemoveExpired 函数按过期时间从早到晚删除最多 limit 个已经过期的缓存项，返回删除的数量，limit 小于等于 0 时不限制数量。
+// 每个缓存项的开销是 O(log n)，调用方可以通过 limit 控制单次清理的耗时。
+func (c *LFUCache) RemoveExpired(limit int) int {
+	now := time.Now()
+	n := 0
+	for (limit <= 0 || n < limit) && len(c.expiry) > 0 && c.expiry[0].expire.Before(now) {
+		c.removeElement(c.expiry[0])
+		n++
 	}
+	return n
 }
 
-// Add 函数用于插入一个缓存项。
+// Add 函数用于插入一个缓存项，缓存项在 ttl 之后过期。
 func (c *LFUCache) Add(key string, value Value, ttl time.Duration) {
+	c.AddWithExpire(key, value, time.Now().Add(ttl))
+}
+
+// AddWithExpire 函数用于插入一个在 expireTime 过期的缓存项。已存在的缓存项会更新值和过期时间，并算作一次访问；
+// 新的缓存项进入频率为 1 的桶。
+func (c *LFUCache) AddWithExpire(key string, value Value, expireTime time.Time) {
+	c.maybeDecay(time.Now())
 	if ele, ok := c.cache[key]; ok {
-		ele.freq++
+		c.nBytes += int64(value.Len()) - int64(ele.value.Len())
 		ele.value = value
-		ele.expire = time.Now().Add(ttl)
-		heap.Fix(c.heap, ele.index)
+		ele.expire = expireTime
+		heap.Fix(&c.expiry, ele.index)
+		c.increment(ele)
 	} else {
 		entry := &entry{
 			key:    key,
 			value:  value,
 			freq:   1,
-			expire: time.Now().Add(ttl),
+			expire: expireTime,
 		}
-		heap.Push(c.heap, entry)
+		front := c.freqs.Front()
+		if front == nil || front.Value.(*bucket).freq != 1 {
+			front = c.freqs.PushFront(&bucket{freq: 1, items: list.New()})
+		}
+		entry.bucket = front
+		entry.elem = front.Value.(*bucket).items.PushFront(entry)
 		c.cache[key] = entry
+		heap.Push(&c.expiry, entry)
 		c.nBytes += int64(len(key)) + int64(value.Len())
 	}
 
@@ -136,17 +146,118 @@ func (c *LFUCache) Add(key string, value Value, ttl time.Duration) {
 	}
 }
 
+// increment 函数把缓存项移动到频率加 1 的桶的最前面，桶不存在时在当前桶之后创建，当前桶空了就删除它。
+func (c *LFUCache) increment(e *entry) {
+	cur := e.bucket
+	next := cur.Next()
+	if next == nil || next.Value.(*bucket).freq != e.freq+1 {
+		next = c.freqs.InsertAfter(&bucket{freq: e.freq + 1, items: list.New()}, cur)
+	}
+	c.unlink(e)
+	e.freq++
+	e.bucket = next
+	e.elem = next.Value.(*bucket).items.PushFront(e)
+}
+
+// maybeDecay 函数在距离上一次衰减超过 decayInterval 时把所有缓存项的频率减半。
+// 减半后频率相同的相邻桶合并，原来频率较高的桶中的缓存项排在前面，视为较近使用。
+func (c *LFUCache) maybeDecay(now time.Time) {
+	if c.decayInterval <= 0 || now.Sub(c.lastDecay) < c.decayInterval {
+		return
+	}
+	c.lastDecay = now
+	var prev *list.Element
+	for e := c.freqs.Front(); e != nil; {
+		next := e.Next()
+		b := e.Value.(*bucket)
+		b.freq = (b.freq + 1) / 2
+		if prev != nil && prev.Value.(*bucket).freq == b.freq {
+			prev.Value.(*bucket).items.PushFrontList(b.items)
+			c.freqs.Remove(e)
+		} else {
+			prev = e
+		}
+		e = next
+	}
+	for e := c.freqs.Front(); e != nil; e = e.Next() { //合并后节点发生了变化，重新记录每个缓存项所在的桶
+		b := e.Value.(*bucket)
+		for item := b.items.Front(); item != nil; item = item.Next() {
+			entry := item.Value.(*entry)
+			entry.freq, entry.bucket, entry.elem = b.freq, e, item
+		}
+	}
+}
+
+// Remove 方法用于主动删除某个键，键不存在时什么也不做。
+func (c *LFUCache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
 // Len 方法返回当前缓存中的记录数量。
 func (c *LFUCache) Len() int {
 	return len(c.cache)
 }
 
+// Bytes 方法返回当前已占用的容量。
+func (c *LFUCache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Clear 方法清空缓存中的所有记录，不会调用 OnEvicted。
+func (c *LFUCache) Clear() {
+	c.freqs.Init()
+	c.cache = make(map[string]*entry)
+	c.expiry = nil
+	c.nBytes = 0
+}
+
+// unlink 函数把缓存项从所在的桶中取出，桶空了就删除它。
+func (c *LFUCache) unlink(e *entry) {
+	b := e.bucket.Value.(*bucket)
+	b.items.Remove(e.elem)
+	if b.items.Len() == 0 {
+		c.freqs.Remove(e.bucket)
+	}
+}
+
 // removeElement 函数删除传入的缓存项。
 func (c *LFUCache) removeElement(e *entry) {
-	heap.Remove(c.heap, e.index)
+	c.unlink(e)
 	delete(c.cache, e.key)
+	heap.Remove(&c.expiry, e.index)
 	c.nBytes -= int64(len(e.key)) + int64(e.value.Len())
 	if c.OnEvicted != nil {
 		c.OnEvicted(e.key, e.value)
 	}
 }
+
+// expiryHeap 实现了 heap.Interface 接口，按过期时间排列缓存项，实现最小堆
+type expiryHeap []*entry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expire.Before(h[j].expire) }
+
+// Swap 函数交换缓存项，包括在堆中的索引
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	entry := x.(*entry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1 // for safety
+	*h = old[:n-1]
+	return entry
+}
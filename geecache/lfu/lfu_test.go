@@ -3,6 +3,7 @@ package lfu
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -12,11 +13,11 @@ func (d String) Len() int {
 }
 
 func TestGet(t *testing.T) {
-	lfu := New(int64(0), nil, 60)
+	lfu := New(int64(0), nil)
 	//在这个特定的上下文中，int64(0) 作为参数传递给 New 函数，用于指定 LRU 缓存的最大存储容量。
 	//在这里，将其设置为 0 表示缓存的最大容量为零，即没有存储空间，因此不会保存任何键值对。
 	//这可以用于创建一个非常小的缓存或用于特定的测试场景，其中不需要实际存储数据。
-	lfu.Add("key1", String("1234"), 60)
+	lfu.Add("key1", String("1234"), time.Minute)
 	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
 		t.Fatalf("cache hit key1=1234 failed")
 	}
@@ -29,7 +30,7 @@ func TestRemoveoldest(t *testing.T) {
 	k1, k2, k3 := "key1", "key2", "k3"
 	v1, v2, v3 := "value1", "value2", "v3"
 	Cap := len(k1 + k2 + v1 + v2)
-	lfu := New(int64(Cap), nil, 60)
+	lfu := New(int64(Cap), nil)
 	lfu.Add(k1, String(v1), 60)
 	lfu.Add(k2, String(v2), 60)
 	lfu.Add(k3, String(v3), 60)
@@ -44,7 +45,7 @@ func TestOnEvicted(t *testing.T) {
 	callback := func(key string, value Value) {
 		keys = append(keys, key)
 	}
-	lfu := New(int64(10), callback, 60)
+	lfu := New(int64(10), callback)
 	lfu.Add("key1", String("123456"), 60)
 	lfu.Add("k2", String("k2"), 60)
 	lfu.Add("k3", String("k3"), 60)
@@ -56,7 +57,7 @@ func TestOnEvicted(t *testing.T) {
 }
 
 func TestAdd(t *testing.T) {
-	lfu := New(int64(0), nil, 60)
+	lfu := New(int64(0), nil)
 	lfu.Add("key", String("1"), 60)
 	lfu.Add("key", String("111"), 60)
 
@@ -64,3 +65,129 @@ func TestAdd(t *testing.T) {
 		t.Fatal("expected 6 but got", lfu.nBytes)
 	}
 }
+
+func TestRemove(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1234"), 60)
+	lfu.Remove("key1")
+	lfu.Remove("key2")
+	if _, ok := lfu.Get("key1"); ok || lfu.Len() != 0 || lfu.nBytes != 0 {
+		t.Fatalf("Remove key1 failed")
+	}
+}
+
+func TestAddWithExpire(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.AddWithExpire("key1", String("1234"), time.Now().Add(time.Minute))
+	lfu.AddWithExpire("key2", String("1234"), time.Now().Add(-time.Second))
+	if _, ok := lfu.Get("key1"); !ok {
+		t.Fatalf("cache hit key1 failed")
+	}
+	if _, ok := lfu.Get("key2"); ok {
+		t.Fatalf("expired key2 should miss")
+	}
+}
+
+func TestClear(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1234"), time.Minute)
+	lfu.Add("key2", String("5678"), time.Minute)
+	if lfu.Bytes() != int64(len("key1")+len("1234"))*2 {
+		t.Fatalf("expected 16 bytes but got %d", lfu.Bytes())
+	}
+	lfu.Clear()
+	if _, ok := lfu.Get("key1"); ok || lfu.Len() != 0 || lfu.Bytes() != 0 {
+		t.Fatalf("Clear failed")
+	}
+	lfu.Add("key1", String("1234"), time.Minute)
+	if _, ok := lfu.Get("key1"); !ok {
+		t.Fatalf("cache should be usable after Clear")
+	}
+}
+
+// 频率最低的记录先被淘汰，频率相同时淘汰最久未使用的记录
+func TestEvictOrder(t *testing.T) {
+	keys := make([]string, 0)
+	lfu := New(int64(12), func(key string, value Value) {
+		keys = append(keys, key)
+	})
+	lfu.Add("k1", String("1"), time.Minute)
+	lfu.Add("k2", String("2"), time.Minute)
+	lfu.Add("k3", String("3"), time.Minute)
+	lfu.Add("k4", String("4"), time.Minute)
+	lfu.Get("k1")
+	lfu.Get("k1")
+	lfu.Get("k3")
+	lfu.Get("k2")
+	lfu.Add("k5", String("5"), time.Minute) //k4 频率最低
+	lfu.Add("k6", String("6"), time.Minute) //k5 频率最低
+	lfu.Add("k7", String("7"), time.Minute) //k6 频率最低
+	lfu.Get("k7")
+	lfu.Add("k8", String("8"), time.Minute) //k8 频率最低，直接被淘汰
+	lfu.RemoveOldest()                      //k3、k2、k7 频率都为 2，k3 最久未使用
+	expect := []string{"k4", "k5", "k6", "k8", "k3"}
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect evicted keys %v, but got %v", expect, keys)
+	}
+}
+
+// 频率衰减后过去的热点频率降低，可以被新的热点淘汰
+func TestDecay(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.SetDecay(time.Hour)
+	lfu.Add("old", String("1"), time.Minute)
+	for i := 0; i < 7; i++ {
+		lfu.Get("old")
+	}
+	lfu.Add("new", String("1"), time.Minute)
+	lfu.Get("new")
+	lfu.Get("new")
+	lfu.Add("cold", String("1"), time.Minute)
+
+	lfu.lastDecay = time.Now().Add(-time.Hour)
+	lfu.Get("cold") //触发衰减：old 8->4，new 3->2，cold 1->1，然后 cold 1->2
+	for key, freq := range map[string]int{"old": 4, "new": 2, "cold": 2} {
+		if e := lfu.cache[key]; e.freq != freq || e.bucket.Value.(*bucket).freq != freq {
+			t.Fatalf("expect frequency of %s to be %d, but got %d", key, freq, e.freq)
+		}
+	}
+	if lfu.freqs.Len() != 2 || lfu.cache["cold"].bucket != lfu.cache["new"].bucket {
+		t.Fatalf("buckets with the same frequency should be merged")
+	}
+	if front := lfu.cache["new"].bucket.Value.(*bucket).items.Front().Value.(*entry); front.key != "cold" {
+		t.Fatalf("cold was accessed most recently and should be in front, but got %s", front.key)
+	}
+
+	lfu.Remove("cold")
+	for i := 0; i < 3; i++ {
+		lfu.Get("new") //new 的频率为 5，没有衰减时 old 的频率为 8，不会被淘汰
+	}
+	lfu.RemoveOldest()
+	if _, ok := lfu.Get("old"); ok {
+		t.Fatalf("old should be evicted after decay")
+	}
+}
+
+// RemoveExpired 按过期时间从早到晚删除已过期的缓存项，淘汰时也优先删除已过期的缓存项
+func TestRemoveExpired(t *testing.T) {
+	keys := make([]string, 0)
+	lfu := New(int64(0), func(key string, value Value) {
+		keys = append(keys, key)
+	})
+	now := time.Now()
+	lfu.AddWithExpire("k1", String("1"), now.Add(-time.Second))
+	lfu.AddWithExpire("k2", String("2"), now.Add(-3*time.Second))
+	lfu.AddWithExpire("k3", String("3"), now.Add(time.Minute))
+	lfu.AddWithExpire("k4", String("4"), now.Add(-2*time.Second))
+	if n := lfu.RemoveExpired(1); n != 1 {
+		t.Fatalf("expect 1 entry removed, but got %d", n)
+	}
+	lfu.maxBytes = lfu.nBytes
+	lfu.Get("k3")
+	lfu.AddWithExpire("k5", String("5"), now.Add(time.Minute)) //k4 已经过期，虽然频率不是最低也先被删除
+	lfu.AddWithExpire("k6", String("6"), now.Add(time.Minute)) //k1 已经过期
+	expect := []string{"k2", "k4", "k1"}
+	if !reflect.DeepEqual(expect, keys) || len(lfu.expiry) != lfu.Len() {
+		t.Fatalf("expect evicted keys %v, but got %v", expect, keys)
+	}
+}
@@ -1,9 +1,9 @@
 package lru
 
 import (
+	"container/heap"
 	"container/list"
 	"log"
-	"math/rand"
 	"time"
 )
 
@@ -14,35 +14,35 @@ nBytes：已占用的容量
 ll：直接使用 Go 语言标准库实现的双向链表list.List，双向链表常用于维护缓存中各个数据的访问顺序，以便在淘汰数据时能够方便地找到最近最少使用的数据。
 cache：map,键是字符串，值是双向链表中对应节点的指针
 OnEvicted：是某条记录被移除时的回调函数，可以为 nil
-defaultTTL：记录在缓存中的默认过期时间
+expiry：按过期时间排列的最小堆，堆顶是最早过期的记录，用于淘汰时优先移除已过期的记录以及 RemoveExpired 主动清理
 */
 type LRUCache struct {
-	maxBytes   int64
-	nBytes     int64
-	ll         *list.List
-	cache      map[string]*list.Element
-	OnEvicted  func(key string, value Value)
-	defaultTTL time.Duration
+	maxBytes  int64
+	nBytes    int64
+	ll        *list.List
+	cache     map[string]*list.Element
+	OnEvicted func(key string, value Value)
+	expiry    expiryHeap
 }
 
 type entry struct {
 	key    string
 	value  Value
 	expire time.Time //节点的过期时间
+	index  int       //在 expiry 堆中的索引，用于快速定位
 } // 键值对 entry 是双向链表节点的数据类型，在链表中仍保存每个值对应的 key 的好处在于，淘汰队首节点时，需要用 key 从字典中删除对应的映射。
 
 type Value interface {
 	Len() int
 } // 为了通用性，我们允许值是实现了 Value 接口的任意类型，该接口只包含了一个方法 Len() int，用于返回值所占用的内存大小。
 
-// New 通过传入maxBytes,onEvicted,defaultTTL这些参数，返回一个LRUCache结构体。
-func New(maxBytes int64, onEvicted func(string, Value), defaultTTL time.Duration) *LRUCache {
+// New 通过传入maxBytes,onEvicted这些参数，返回一个LRUCache结构体。
+func New(maxBytes int64, onEvicted func(string, Value)) *LRUCache {
 	return &LRUCache{
-		maxBytes:   maxBytes,
-		ll:         list.New(),
-		cache:      make(map[string]*list.Element),
-		OnEvicted:  onEvicted,
-		defaultTTL: defaultTTL,
+		maxBytes:  maxBytes,
+		ll:        list.New(),
+		cache:     make(map[string]*list.Element),
+		OnEvicted: onEvicted,
 	}
 }
 
@@ -61,34 +61,57 @@ func (c *LRUCache) Get(key string) (value Value, ok bool) {
 	return
 }
 
-// RemoveOldest 函数找到最久未使用且已过期的缓存项，然后将其从缓存中移除。
+// RemoveOldest 函数移除一条记录：最早过期的记录已经过期时优先移除它，否则移除最久未使用的记录，
+// 保证每次调用都能释放容量。缓存为空时什么也不做。
 func (c *LRUCache) RemoveOldest() {
-	for e := c.ll.Back(); e != nil; e = e.Prev() {
-		kv := e.Value.(*entry)
-		if kv.expire.Before(time.Now()) {
-			c.RemoveElement(e)
-			break
-		}
+	if len(c.expiry) > 0 && c.expiry[0].expire.Before(time.Now()) {
+		c.RemoveElement(c.cache[c.expiry[0].key])
+		return
 	}
+	if e := c.ll.Back(); e != nil {
+		c.RemoveElement(e)
+	}
+}
+
+// RemoveExpired 函数按过期时间从早到晚移除最多 limit 条已经过期的记录，返回移除的数量，limit 小于等于 0 时不限制数量。
+// 每条记录的开销是 O(log n)，调用方可以通过 limit 控制单次清理的耗时。
+func (c *LRUCache) RemoveExpired(limit int) int {
+	now := time.Now()
+	n := 0
+	for (limit <= 0 || n < limit) && len(c.expiry) > 0 && c.expiry[0].expire.Before(now) {
+		c.RemoveElement(c.cache[c.expiry[0].key])
+		n++
+	}
+	return n
+}
+
+// Add 方法用于向缓存中添加新的键值对，键值对在 ttl 之后过期，等价于 AddWithExpire(key, value, time.Now().Add(ttl))。
+func (c *LRUCache) Add(key string, value Value, ttl time.Duration) {
+	c.AddWithExpire(key, value, time.Now().Add(ttl))
 }
 
-// Add 方法用于向缓存中添加新的键值对。如果键已存在，则更新对应的值，并将节点移动到链表的最前面；
+// AddWithExpire 方法用于向缓存中添加新的键值对，键值对在 expireTime 过期。如果键已存在，则更新对应的值和过期时间，并将节点移动到链表的最前面；
 // 如果键不存在，则在链表头部插入新的节点，并更新已占用的容量。
 // 如果添加新的键值对后超出了最大存储容量，则会连续移除最久未使用的记录，直到满足容量要求。
-func (c *LRUCache) Add(key string, value Value, ttl time.Duration) {
-	expireTime := time.Now().Add(ttl + time.Duration(rand.Intn(60))*time.Second)
+// 缓存本身不再给过期时间加随机抖动，由调用方（Group）决定，这样数据源给出的过期时间可以被准确地遵守。
+// 单条记录大于 maxBytes 时不会被缓存，同名的旧值也会被删除，避免把其他记录全部淘汰后仍然超出容量。
+func (c *LRUCache) AddWithExpire(key string, value Value, expireTime time.Time) {
+	if c.maxBytes != 0 && int64(len(key))+int64(value.Len()) > c.maxBytes {
+		c.Remove(key)
+		return
+	}
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		c.nBytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
-		// 更新过期时间时，判断是否应该保留原本的过期时间
-		if kv.expire.Before(expireTime) {
-			kv.expire = expireTime
-		}
+		kv.expire = expireTime // 新的值带有自己的过期时间
+		heap.Fix(&c.expiry, kv.index)
 	} else {
-		ele = c.ll.PushFront(&entry{key: key, value: value, expire: expireTime})
+		kv := &entry{key: key, value: value, expire: expireTime}
+		ele = c.ll.PushFront(kv)
 		c.cache[key] = ele
+		heap.Push(&c.expiry, kv)
 		c.nBytes += int64(len(key)) + int64(value.Len())
 	}
 	for c.maxBytes != 0 && c.maxBytes < c.nBytes {
@@ -99,18 +122,68 @@ func (c *LRUCache) Add(key string, value Value, ttl time.Duration) {
 	//因此，不需要在 Add 方法中执行删除最旧的缓存项 (RemoveOldest) 的操作。
 }
 
+// Remove 方法用于主动删除某个键，键不存在时什么也不做。
+func (c *LRUCache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.RemoveElement(ele)
+	}
+}
+
 // Len 方法返回当前缓存中的记录数量。
 func (c *LRUCache) Len() int {
 	return c.ll.Len()
 }
 
+// Bytes 方法返回当前已占用的容量。
+func (c *LRUCache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Clear 方法清空缓存中的所有记录，不会调用 OnEvicted。
+func (c *LRUCache) Clear() {
+	c.ll.Init()
+	c.cache = make(map[string]*list.Element)
+	c.expiry = nil
+	c.nBytes = 0
+}
+
 // RemoveElement 函数用于删除某个节点
 func (c *LRUCache) RemoveElement(e *list.Element) {
 	c.ll.Remove(e)
 	kv := e.Value.(*entry)
 	delete(c.cache, kv.key)                                //删除key-节点这对映射
+	heap.Remove(&c.expiry, kv.index)                       //删除过期时间堆中的节点
 	c.nBytes -= int64(len(kv.key)) + int64(kv.value.Len()) //重新计算已用容量
 	if c.OnEvicted != nil {
 		c.OnEvicted(kv.key, kv.value) //调用对应的回调函数
 	}
 }
+
+// expiryHeap 实现了 heap.Interface 接口，按过期时间排列记录，实现最小堆
+type expiryHeap []*entry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expire.Before(h[j].expire) }
+
+// Swap 函数交换记录，包括在堆中的索引
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	kv := x.(*entry)
+	kv.index = len(*h)
+	*h = append(*h, kv)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	kv := old[n-1]
+	old[n-1] = nil
+	kv.index = -1
+	*h = old[:n-1]
+	return kv
+}
@@ -2,7 +2,11 @@ package lru
 
 import (
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/quick"
+	"time"
 )
 
 type String string
@@ -12,11 +16,11 @@ func (d String) Len() int {
 }
 
 func TestGet(t *testing.T) {
-	lru := New(int64(0), nil, 60)
+	lru := New(int64(0), nil)
 	//在这个特定的上下文中，int64(0) 作为参数传递给 New 函数，用于指定 LRU 缓存的最大存储容量。
 	//在这里，将其设置为 0 表示缓存的最大容量为零，即没有存储空间，因此不会保存任何键值对。
 	//这可以用于创建一个非常小的缓存或用于特定的测试场景，其中不需要实际存储数据。
-	lru.Add("key1", String("1234"), 60)
+	lru.Add("key1", String("1234"), time.Minute)
 	if v, ok := lru.Get("key1"); !ok || string(v.(String)) != "1234" {
 		t.Fatalf("cache hit key1=1234 failed")
 	}
@@ -29,7 +33,7 @@ func TestRemoveoldest(t *testing.T) {
 	k1, k2, k3 := "key1", "key2", "k3"
 	v1, v2, v3 := "value1", "value2", "v3"
 	Cap := len(k1 + k2 + v1 + v2)
-	lru := New(int64(Cap), nil, 60)
+	lru := New(int64(Cap), nil)
 	lru.Add(k1, String(v1), 60)
 	lru.Add(k2, String(v2), 60)
 	lru.Add(k3, String(v3), 60)
@@ -44,7 +48,7 @@ func TestOnEvicted(t *testing.T) {
 	callback := func(key string, value Value) {
 		keys = append(keys, key)
 	}
-	lru := New(int64(10), callback, 60)
+	lru := New(int64(10), callback)
 	lru.Add("key1", String("123456"), 60)
 	lru.Add("k2", String("k2"), 60)
 	lru.Add("k3", String("k3"), 60)
@@ -56,7 +60,7 @@ func TestOnEvicted(t *testing.T) {
 }
 
 func TestAdd(t *testing.T) {
-	lru := New(int64(0), nil, 60)
+	lru := New(int64(0), nil)
 	lru.Add("key", String("1"), 60)
 	lru.Add("key", String("111"), 60)
 
@@ -64,3 +68,154 @@ func TestAdd(t *testing.T) {
 		t.Fatal("expected 6 but got", lru.nBytes)
 	}
 }
+
+func TestRemove(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1234"), 60)
+	lru.Remove("key1")
+	lru.Remove("key2")
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 0 || lru.nBytes != 0 {
+		t.Fatalf("Remove key1 failed")
+	}
+}
+
+func TestAddWithExpire(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.AddWithExpire("key1", String("1234"), time.Now().Add(time.Minute))
+	lru.AddWithExpire("key2", String("1234"), time.Now().Add(-time.Second))
+	if _, ok := lru.Get("key1"); !ok {
+		t.Fatalf("cache hit key1 failed")
+	}
+	if _, ok := lru.Get("key2"); ok {
+		t.Fatalf("expired key2 should miss")
+	}
+	// 更新值时使用新的过期时间，即使它比原来的早
+	lru.AddWithExpire("key1", String("5678"), time.Now().Add(-time.Second))
+	if _, ok := lru.Get("key1"); ok {
+		t.Fatalf("key1 should expire with its new expire time")
+	}
+}
+
+func TestClear(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1234"), time.Minute)
+	lru.Add("key2", String("5678"), time.Minute)
+	if lru.Bytes() != int64(len("key1")+len("1234"))*2 {
+		t.Fatalf("expected 16 bytes but got %d", lru.Bytes())
+	}
+	lru.Clear()
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 0 || lru.Bytes() != 0 {
+		t.Fatalf("Clear failed")
+	}
+	lru.Add("key1", String("1234"), time.Minute)
+	if _, ok := lru.Get("key1"); !ok {
+		t.Fatalf("cache should be usable after Clear")
+	}
+}
+
+// 没有过期的记录时淘汰最久未使用的记录，有过期的记录时优先淘汰过期的记录
+func TestRemoveoldestUnexpired(t *testing.T) {
+	keys := make([]string, 0)
+	lru := New(int64(12), func(key string, value Value) {
+		keys = append(keys, key)
+	})
+	lru.Add("k1", String("1"), time.Minute)
+	lru.Add("k2", String("2"), time.Minute)
+	lru.Add("k3", String("3"), -time.Second)
+	lru.Add("k4", String("4"), time.Minute)
+	lru.Get("k1")
+	lru.Add("k5", String("5"), time.Minute) //k3 已经过期
+	lru.Add("k6", String("6"), time.Minute) //k2 最久未使用
+	expect := []string{"k3", "k2"}
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect evicted keys %v, but got %v", expect, keys)
+	}
+}
+
+// 大于 maxBytes 的值不会被缓存，也不会淘汰其他记录
+func TestAddTooLarge(t *testing.T) {
+	lru := New(int64(10), nil)
+	lru.Add("k1", String("1"), time.Minute)
+	lru.Add("k2", String("1"), time.Minute)
+	lru.Add("k2", String("0123456789"), time.Minute)
+	if _, ok := lru.Get("k2"); ok || lru.Len() != 1 || lru.Bytes() != 3 {
+		t.Fatalf("value larger than maxBytes should not be cached")
+	}
+}
+
+// op 是随机生成的一次缓存操作，由 testing/quick 填充
+type op struct {
+	Kind    uint8 //0-5 写入，6-7 读取，8 删除
+	Key     uint8
+	Len     uint8
+	Expired bool
+}
+
+// TestQuickCapacity 对随机的操作序列检查每次操作之后 nBytes 都不超过 maxBytes，并且与实际保存的记录一致
+func TestQuickCapacity(t *testing.T) {
+	f := func(maxBytes uint8, ops []op) bool {
+		lru := New(int64(maxBytes), nil)
+		for _, o := range ops {
+			key := "k" + strconv.Itoa(int(o.Key%32))
+			switch o.Kind % 9 {
+			case 6, 7:
+				lru.Get(key)
+			case 8:
+				lru.Remove(key)
+			default:
+				ttl := time.Minute
+				if o.Expired {
+					ttl = -time.Second
+				}
+				lru.Add(key, String(strings.Repeat("v", int(o.Len%64))), ttl)
+			}
+			if maxBytes != 0 && lru.nBytes > int64(maxBytes) {
+				return false
+			}
+			if !consistent(lru) {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 500}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// consistent 检查链表、map 和 nBytes 三者是否一致
+func consistent(lru *LRUCache) bool {
+	var nBytes int64
+	for e := lru.ll.Front(); e != nil; e = e.Next() {
+		kv := e.Value.(*entry)
+		if lru.cache[kv.key] != e {
+			return false
+		}
+		nBytes += int64(len(kv.key)) + int64(kv.value.Len())
+	}
+	return nBytes == lru.nBytes && lru.ll.Len() == len(lru.cache) && len(lru.expiry) == len(lru.cache)
+}
+
+// RemoveExpired 按过期时间从早到晚移除已过期的记录，每次最多移除 limit 条
+func TestRemoveExpired(t *testing.T) {
+	keys := make([]string, 0)
+	lru := New(int64(0), func(key string, value Value) {
+		keys = append(keys, key)
+	})
+	now := time.Now()
+	lru.AddWithExpire("k1", String("1"), now.Add(-time.Second))
+	lru.AddWithExpire("k2", String("2"), now.Add(-3*time.Second))
+	lru.AddWithExpire("k3", String("3"), now.Add(time.Minute))
+	lru.AddWithExpire("k4", String("4"), now.Add(-2*time.Second))
+	lru.AddWithExpire("k1", String("1"), now.Add(-4*time.Second)) //更新过期时间
+	if n := lru.RemoveExpired(2); n != 2 {
+		t.Fatalf("expect 2 entries removed, but got %d", n)
+	}
+	if n := lru.RemoveExpired(0); n != 1 {
+		t.Fatalf("expect 1 entry removed, but got %d", n)
+	}
+	expect := []string{"k1", "k2", "k4"}
+	if !reflect.DeepEqual(expect, keys) || lru.Len() != 1 || lru.Bytes() != 3 || len(lru.expiry) != 1 {
+		t.Fatalf("expect evicted keys %v, but got %v", expect, keys)
+	}
+}
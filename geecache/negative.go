@@ -0,0 +1,83 @@
+package geecache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound 表示数据源中不存在该 key。Getter 返回的错误满足 errors.Is(err, ErrNotFound) 时，
+// 这次查询结果会被缓存一段时间（见 Group.SetNegativeTTL），期间对该 key 的请求直接返回错误，不再访问数据源和远程节点。
+// Getter 可以用 fmt.Errorf("%s not exist: %w", key, ErrNotFound) 的方式返回带有上下文的错误。
+var ErrNotFound = errors.New("not found")
+
+const defaultNegativeKeys = 10000 //负缓存最多记录的 key 数量，避免大量不存在的 key 耗尽内存
+
+// negativeCache 记录数据源中不存在的 key 及其过期时间。
+// 它不占用 mainCache 的容量，已满时先清理过期的 key，仍然没有空间时随机丢弃一个 key。
+type negativeCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration        //负缓存的过期时间，为 0 时关闭负缓存
+	maxKeys int                  //最多记录的 key 数量
+	keys    map[string]time.Time //key 及其过期时间
+}
+
+// setTTL 设置负缓存的过期时间，ttl 小于等于 0 时关闭负缓存并清空已有的记录
+func (c *negativeCache) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ttl <= 0 {
+		ttl = 0
+		c.keys = nil
+	}
+	c.ttl = ttl
+}
+
+// add 记录 key 在数据源中不存在
+func (c *negativeCache) add(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl == 0 {
+		return
+	}
+	if c.keys == nil {
+		c.keys = make(map[string]time.Time)
+	}
+	now := time.Now()
+	if _, ok := c.keys[key]; !ok && len(c.keys) >= c.maxKeys {
+		for k, expire := range c.keys {
+			if expire.Before(now) {
+				delete(c.keys, k)
+			}
+		}
+		for k := range c.keys { //map 的遍历顺序是随机的
+			if len(c.keys) < c.maxKeys {
+				break
+			}
+			delete(c.keys, k)
+		}
+	}
+	c.keys[key] = now.Add(c.ttl)
+}
+
+// has 判断 key 是否被记录为不存在且尚未过期，过期的记录会被惰性删除
+func (c *negativeCache) has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expire, ok := c.keys[key]
+	if !ok {
+		return false
+	}
+	if expire.Before(time.Now()) {
+		delete(c.keys, key)
+		return false
+	}
+	return true
+}
+
+// remove 删除 key 的记录，key 被写入新的值之后调用
+func (c *negativeCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.keys, key)
+}
@@ -0,0 +1,149 @@
+package geecache
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultCacheBytes       = 64 << 20 //默认的 mainCache 容量
+	defaultHotKeyThreshold  = 10       //默认的热点 key 阈值，每分钟从远程节点获取的次数
+	defaultHotCacheFraction = 8        //hotCache 的默认容量是 mainCache 的 1/8
+)
+
+// groupOptions 是创建 Group 时的配置，由 GroupOption 修改
+type groupOptions struct {
+	policy       string                           //缓存淘汰算法
+	cacheBytes   int64                            //mainCache 的容量，0 表示不限制
+	hotBytes     int64                            //hotCache 的容量，小于 0 时为 cacheBytes 的 1/8
+	ttl          time.Duration                    //默认的过期时间
+	jitter       time.Duration                    //默认过期时间的最大随机抖动
+	hotThreshold int                              //热点 key 阈值
+	negativeTTL  time.Duration                    //负缓存的过期时间，0 表示不开启
+	onEvicted    func(key string, value ByteView) //mainCache 中的记录被移除时的回调
+	janitor      time.Duration                    //后台清理过期记录的周期，0 表示不开启
+	loadTimeout  time.Duration                    //一次共享加载的超时时间
+	softTTL      time.Duration                    //软过期时间，0 表示不开启
+	refresh      time.Duration                    //提前刷新窗口，0 表示不开启
+}
+
+// GroupOption 用于在 NewGroupWithOptions 中修改缓存组的默认配置
+type GroupOption func(*groupOptions)
+
+// WithPolicy 设置缓存淘汰算法，默认为 "lru"，可选 "lru"、"lfu"、"tinylfu"、"arc"、"2q" 以及通过 RegisterPolicy 注册的算法
+func WithPolicy(policy string) GroupOption {
+	return func(o *groupOptions) {
+		o.policy = policy
+	}
+}
+
+// WithCacheBytes 设置 mainCache 的容量，默认为 64MB，0 表示不限制
+func WithCacheBytes(cacheBytes int64) GroupOption {
+	return func(o *groupOptions) {
+		o.cacheBytes = cacheBytes
+	}
+}
+
+// WithHotCacheBytes 设置 hotCache 的容量，默认为 mainCache 容量的 1/8，0 表示不限制
+func WithHotCacheBytes(hotBytes int64) GroupOption {
+	return func(o *groupOptions) {
+		o.hotBytes = hotBytes
+	}
+}
+
+// WithTTL 设置默认的过期时间，默认为 60s。数据源通过 ExpiringGetter 指定的过期时间优先
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithJitter 设置默认过期时间的最大随机抖动，默认为 60s，0 表示不加抖动
+func WithJitter(jitter time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.jitter = jitter
+	}
+}
+
+// WithHotKeyThreshold 设置热点 key 的阈值，默认为 10。
+// 一个 key 平均每分钟从远程节点获取的次数达到 n 时，它会被放入 hotCache，之后直接在本地返回
+func WithHotKeyThreshold(n int) GroupOption {
+	return func(o *groupOptions) {
+		o.hotThreshold = n
+	}
+}
+
+// WithNegativeCache 开启负缓存，数据源返回 ErrNotFound 的 key 在 ttl 内直接返回不存在，见 Group.SetNegativeTTL
+func WithNegativeCache(ttl time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithSoftTTL 设置软过期时间，默认为 0，即不开启，见 Group.SetSoftTTL
+func WithSoftTTL(ttl time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.softTTL = ttl
+	}
+}
+
+// WithRefreshAhead 设置提前刷新窗口，默认为 0，即不开启，见 Group.SetRefreshAhead
+func WithRefreshAhead(window time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.refresh = window
+	}
+}
+
+// WithOnEvicted 设置 mainCache 中的记录因淘汰、过期或删除而被移除时的回调。
+// 回调在缓存的锁内执行，不能再调用该缓存组的方法，耗时的操作应当交给其他协程
+func WithOnEvicted(onEvicted func(key string, value ByteView)) GroupOption {
+	return func(o *groupOptions) {
+		o.onEvicted = onEvicted
+	}
+}
+
+// WithJanitor 开启后台清理过期记录的协程，每隔 interval 从 mainCache 和 hotCache 中各清理一批过期记录，默认不开启。
+// 不开启时过期记录只在被读取或者容量不足时才会被移除。只有实现了 Expirer 的淘汰算法（"lru"、"lfu"）会被清理，
+// 协程在 Group.Close 时退出
+func WithJanitor(interval time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.janitor = interval
+	}
+}
+
+// WithLoadTimeout 设置一次加载（依次访问远程节点，失败后回退到数据源）的最长时间，默认为 10s。
+// 同一个 key 的并发请求共享一次加载，加载的截止时间是这些请求中最晚的截止时间，但不超过该超时；
+// 某个请求放弃不会中断加载，所有请求都放弃时加载被取消
+func WithLoadTimeout(timeout time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.loadTimeout = timeout
+	}
+}
+
+// validate 检查配置是否合法
+func (o *groupOptions) validate() error {
+	if _, ok := lookupPolicy(o.policy); !ok {
+		return fmt.Errorf("unknown cache policy %q", o.policy)
+	}
+	switch {
+	case o.cacheBytes < 0:
+		return fmt.Errorf("invalid cache bytes %d", o.cacheBytes)
+	case o.ttl <= 0:
+		return fmt.Errorf("invalid ttl %v", o.ttl)
+	case o.jitter < 0:
+		return fmt.Errorf("invalid jitter %v", o.jitter)
+	case o.hotThreshold < 1:
+		return fmt.Errorf("invalid hot key threshold %d", o.hotThreshold)
+	case o.negativeTTL < 0:
+		return fmt.Errorf("invalid negative cache ttl %v", o.negativeTTL)
+	case o.janitor < 0:
+		return fmt.Errorf("invalid janitor interval %v", o.janitor)
+	case o.softTTL < 0:
+		return fmt.Errorf("invalid soft ttl %v", o.softTTL)
+	case o.refresh < 0:
+		return fmt.Errorf("invalid refresh ahead window %v", o.refresh)
+	case o.loadTimeout <= 0:
+		return fmt.Errorf("invalid load timeout %v", o.loadTimeout)
+	}
+	return nil
+}
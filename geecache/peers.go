@@ -1,14 +1,54 @@
 package geecache
 
-import pb "Geecache/geecache/geecachepb"
+import (
+	"Geecache/geecache/consistenthash"
+	pb "Geecache/geecache/geecachepb"
+	"Geecache/geecache/jumphash"
+	"Geecache/geecache/rendezvous"
+	"context"
+)
 
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
+	PickPeers(key string, n int) []PeerGetter
+	AllPeers() []PeerGetter
 }
 
 type PeerGetter interface {
-	Get(in *pb.Request, out *pb.Response) error
+	Get(ctx context.Context, in *pb.Request, out *pb.GetResponse) error
+	Put(ctx context.Context, in *pb.PutRequest) error
+	Remove(ctx context.Context, in *pb.Request) error
+	Invalidate(ctx context.Context, in *pb.Request) error
 }
 
 //在这里，抽象出 2 个接口，PeerPicker 的 PickPeer() 方法用于根据传入的 key 选择相应节点 PeerGetter。
+//PeerPicker 的 PickPeers() 方法按优先级返回负责该 key 的最多 n 个远程节点，第一个与 PickPeer() 相同，
+//后面的节点是拥有者不可用时的备选节点。遇到当前节点时列表截止，此时应由当前节点从数据源获取。
+//PeerPicker 的 AllPeers() 方法返回除自己以外的所有节点，用于向整个集群广播失效通知。
 //接口 PeerGetter 的 Get() 方法用于从对应 group 查找缓存值。PeerGetter 就对应于上述流程中相应远程节点的客户端。
+//Get() 的 ctx 携带调用方的超时与取消信号，实现方需要在 ctx 结束时尽快返回。out 中的 NotFound 表示 key 不存在，
+//Expire 是拥有者给出的过期时间，Version 是缓存值在拥有者上的加载时间，可以用来比较同一个 key 的两个值哪个更新，为 0 时表示未知。
+//Put() 和 Remove() 用于在拥有该 key 的节点上写入和删除缓存值，Invalidate() 用于删除远程节点 hotCache 中的副本，以及不是拥有者的远程节点 mainCache 中的副本。
+
+// Placement 决定 key 由集群中的哪个节点负责，Server 用它把 key 映射到节点地址。
+// consistenthash、rendezvous 和 jumphash 三个包分别实现了一致性哈希环、最高随机权重哈希和跳跃一致性哈希。
+// Get() 返回 key 的拥有者，GetN() 按优先级返回前 n 个不同的节点，第一个与 Get() 相同。
+// 实现不需要并发安全，Server 会在锁的保护下访问。
+type Placement interface {
+	Add(nodes ...string)
+	Remove(nodes ...string)
+	Get(key string) string
+	GetN(key string, n int) []string
+}
+
+// weightedPlacement 是支持节点权重的 Placement，不支持权重的实现会忽略节点的权重
+type weightedPlacement interface {
+	Placement
+	AddWeighted(node string, weight int)
+}
+
+var (
+	_ weightedPlacement = (*consistenthash.Map)(nil)
+	_ weightedPlacement = (*rendezvous.Rendezvous)(nil)
+	_ Placement         = (*jumphash.JumpHash)(nil)
+)
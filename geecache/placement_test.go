@@ -0,0 +1,96 @@
+package geecache
+
+import (
+	"Geecache/geecache/jumphash"
+	"Geecache/geecache/rendezvous"
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+)
+
+var placements = []struct {
+	name string
+	new  func() Placement
+}{
+	{"consistenthash", defaultPlacement},
+	{"rendezvous", func() Placement { return rendezvous.New(nil) }},
+	{"jumphash", func() Placement { return jumphash.New(nil) }},
+}
+
+// 三种算法都应满足 Placement 的约定：GetN 的第一个节点就是 Get 的结果，且节点各不相同
+func TestPlacementGetN(t *testing.T) {
+	for _, p := range placements {
+		pl := p.new()
+		if pl.Get("key") != "" || len(pl.GetN("key", 2)) != 0 {
+			t.Fatalf("%s: empty placement should return no node", p.name)
+		}
+		pl.Add("a", "b", "c")
+		for i := 0; i < 100; i++ {
+			key := "key" + strconv.Itoa(i)
+			nodes := pl.GetN(key, 3)
+			if len(nodes) != 3 || nodes[0] != pl.Get(key) {
+				t.Fatalf("%s: GetN(%s, 3) = %v, first should be %s", p.name, key, nodes, pl.Get(key))
+			}
+			if nodes[0] == nodes[1] || nodes[1] == nodes[2] || nodes[0] == nodes[2] {
+				t.Fatalf("%s: GetN(%s, 3) = %v has duplicate nodes", p.name, key, nodes)
+			}
+		}
+	}
+}
+
+/*
+BenchmarkPlacement 比较三种节点选择算法，除了 Get 的耗时，还通过 b.ReportMetric 报告：
+stddev%：10 个节点分到的 key 数量的标准差与平均值之比，越小分布越均匀；
+add-moved%：新增第 11 个节点（按名称排在最后）后拥有者发生变化的 key 的比例，理想值是 1/11 ≈ 9.1%；
+remove-moved%：删除中间的一个节点后拥有者发生变化的 key 的比例，理想值是 1/10 = 10%。
+运行：go test -run NONE -bench Placement ./geecache
+*/
+func BenchmarkPlacement(b *testing.B) {
+	const nodes, keys = 10, 100000
+	addrs := make([]string, nodes)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("10.0.0.%d:9999", i+1)
+	}
+	for _, p := range placements {
+		b.Run(p.name, func(b *testing.B) {
+			pl := p.new()
+			pl.Add(addrs...)
+			owners := make([]string, keys)
+			count := make(map[string]int, nodes)
+			for i := range owners {
+				owners[i] = pl.Get("key" + strconv.Itoa(i))
+				count[owners[i]]++
+			}
+			mean, variance := float64(keys)/nodes, 0.0
+			for _, addr := range addrs {
+				d := float64(count[addr]) - mean
+				variance += d * d
+			}
+
+			added := p.new()
+			added.Add(append(addrs, "10.0.1.1:9999")...)
+			removed := p.new()
+			removed.Add(addrs...)
+			removed.Remove(addrs[nodes/2])
+			addMoved, removeMoved := 0, 0
+			for i, owner := range owners {
+				key := "key" + strconv.Itoa(i)
+				if added.Get(key) != owner {
+					addMoved++
+				}
+				if removed.Get(key) != owner {
+					removeMoved++
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				pl.Get(strconv.Itoa(i))
+			}
+			b.ReportMetric(math.Sqrt(variance/nodes)/mean*100, "stddev%")
+			b.ReportMetric(float64(addMoved)/keys*100, "add-moved%")
+			b.ReportMetric(float64(removeMoved)/keys*100, "remove-moved%")
+		})
+	}
+}
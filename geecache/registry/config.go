@@ -0,0 +1,127 @@
+package registry
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	defaultEndpoint    = "localhost:2379" // etcd服务器的地址，这里使用本地地址和默认端口
+	defaultDialTimeout = 5 * time.Second  // 建立连接的超时时间为5秒
+	defaultLeaseTTL    = 5 * time.Second  // 注册服务时租约的有效期为5秒
+	defaultPrefix      = "geecache"       // 服务名称，节点注册在 geecache/<ip:port>/node 下
+	nodeSuffix         = "/node"          // etcd的 resolver 解析服务 <Prefix>/<ip:port> 时读取以 <Prefix>/<ip:port>/ 开头的 key
+)
+
+/*
+Config 是访问etcd以及在etcd中注册服务的配置，零值表示全部使用默认值：
+Endpoints 是etcd服务器的地址，为空时使用 localhost:2379；
+Username 和 Password 是etcd开启身份认证时使用的用户名和密码；
+TLS 是访问etcd的 TLS 配置，通常由 tlsutil.Config.ClientConfig 创建，为 nil 时使用明文连接；
+DialTimeout 是建立连接的超时时间，为 0 时使用 5 秒；
+LeaseTTL 是注册服务时租约的有效期，节点异常退出后最多经过这么久才会从集群中移除，为 0 时使用 5 秒，向上取整到秒；
+Prefix 是服务名称，节点注册在 <Prefix>/<ip:port>/node 下，并且只会发现同一个前缀下的节点。
+旧版本注册在 <Prefix>/<ip:port> 下，新旧版本的节点互相无法发现和连接，升级时需要同时替换所有节点，或者让新版本使用新的前缀；
+为不同的集群设置不同的前缀，就可以让它们共用一个etcd。为空时使用 geecache，不能包含 /，避免一个集群的前缀是另一个集群的前缀的一部分；
+Dial 用于创建etcd客户端，为 nil 时使用 clientv3.New，测试时可以替换为 etcdtest.Server.Dial。
+*/
+type Config struct {
+	Endpoints   []string
+	Username    string
+	Password    string
+	TLS         *tls.Config
+	DialTimeout time.Duration
+	LeaseTTL    time.Duration
+	Prefix      string
+	Dial        func(clientv3.Config) (*clientv3.Client, error)
+}
+
+// Validate 检查配置是否合法
+func (c Config) Validate() error {
+	if c.DialTimeout < 0 {
+		return fmt.Errorf("invalid dial timeout %v", c.DialTimeout)
+	}
+	if c.LeaseTTL < 0 {
+		return fmt.Errorf("invalid lease TTL %v", c.LeaseTTL)
+	}
+	if strings.Contains(c.Prefix, "/") {
+		return fmt.Errorf("invalid prefix %q, it must not contain /", c.Prefix)
+	}
+	return nil
+}
+
+// EtcdConfig 返回创建etcd客户端的配置，没有设置的字段使用默认值
+func (c Config) EtcdConfig() clientv3.Config {
+	cfg := clientv3.Config{
+		Endpoints:   c.Endpoints,
+		Username:    c.Username,
+		Password:    c.Password,
+		TLS:         c.TLS,
+		DialTimeout: c.DialTimeout,
+	}
+	if len(cfg.Endpoints) == 0 {
+		cfg.Endpoints = []string{defaultEndpoint}
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = defaultDialTimeout
+	}
+	return cfg
+}
+
+// NewClient 使用 Dial 和 EtcdConfig 创建etcd客户端
+func (c Config) NewClient() (*clientv3.Client, error) {
+	if c.Dial != nil {
+		return c.Dial(c.EtcdConfig())
+	}
+	return clientv3.New(c.EtcdConfig())
+}
+
+// Service 返回服务名称，即 Prefix，为空时使用默认值
+func (c Config) Service() string {
+	if c.Prefix == "" {
+		return defaultPrefix
+	}
+	return c.Prefix
+}
+
+// target 返回地址为 addr 的节点的服务名称，即 <Prefix>/<addr>，通过etcd的 resolver 连接节点时使用
+func (c Config) target(addr string) string {
+	return c.Service() + "/" + addr
+}
+
+// Key 返回地址为 addr 的节点在etcd中的 key
+func (c Config) Key(addr string) string {
+	return c.target(addr) + nodeSuffix
+}
+
+// Addr 从 Key 返回的 key 中解析出节点地址，key 不是当前前缀下的节点时返回 false
+func (c Config) Addr(key string) (string, bool) {
+	key, ok := strings.CutSuffix(key, nodeSuffix)
+	if !ok {
+		return "", false
+	}
+	return c.legacyAddr(key)
+}
+
+// legacyAddr 从旧版本注册的 key（<Prefix>/<addr>）中解析出节点地址
+func (c Config) legacyAddr(key string) (string, bool) {
+	addr, ok := strings.CutPrefix(key, c.Service()+"/")
+	if !ok || addr == "" || strings.Contains(addr, "/") {
+		return "", false
+	}
+	return addr, true
+}
+
+// leaseSeconds 返回以秒为单位的租约有效期，etcd的租约最短为 1 秒
+func (c Config) leaseSeconds() int64 {
+	ttl := c.LeaseTTL
+	if ttl == 0 {
+		ttl = defaultLeaseTTL
+	}
+	return int64(math.Max(1, math.Ceil(ttl.Seconds())))
+}
@@ -0,0 +1,66 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	var cfg Config
+	etcd := cfg.EtcdConfig()
+	if !reflect.DeepEqual(etcd.Endpoints, []string{defaultEndpoint}) || etcd.DialTimeout != defaultDialTimeout || etcd.TLS != nil {
+		t.Fatalf("unexpected default etcd config %+v", etcd)
+	}
+	if cfg.Key("127.0.0.1:8001") != "geecache/127.0.0.1:8001/node" || cfg.leaseSeconds() != 5 {
+		t.Fatalf("unexpected defaults %s, %d", cfg.Key("127.0.0.1:8001"), cfg.leaseSeconds())
+	}
+
+	cfg = Config{
+		Endpoints:   []string{"etcd-0:2379", "etcd-1:2379"},
+		Username:    "geecache",
+		Password:    "secret",
+		DialTimeout: time.Second,
+		LeaseTTL:    1500 * time.Millisecond,
+		Prefix:      "cluster-b",
+	}
+	etcd = cfg.EtcdConfig()
+	if !reflect.DeepEqual(etcd.Endpoints, cfg.Endpoints) || etcd.Username != "geecache" || etcd.Password != "secret" || etcd.DialTimeout != time.Second {
+		t.Fatalf("unexpected etcd config %+v", etcd)
+	}
+	if cfg.Key("127.0.0.1:8001") != "cluster-b/127.0.0.1:8001/node" {
+		t.Fatalf("unexpected key %s", cfg.Key("127.0.0.1:8001"))
+	}
+	for key, expect := range map[string]string{
+		"cluster-b/127.0.0.1:8001/node":  "127.0.0.1:8001",
+		"cluster-b/127.0.0.1:8001":       "", //旧版本的 key，etcd的 resolver 无法解析
+		"cluster-bb/127.0.0.1:8001/node": "",
+		"cluster-b/a/b/node":             "",
+	} {
+		if addr, ok := cfg.Addr(key); addr != expect || ok != (expect != "") {
+			t.Errorf("Addr(%q) = %q, %v, expect %q", key, addr, ok, expect)
+		}
+	}
+	if cfg.leaseSeconds() != 2 { //向上取整到秒
+		t.Fatalf("expect lease of 2s, but got %d", cfg.leaseSeconds())
+	}
+	cfg.LeaseTTL = time.Millisecond
+	if cfg.leaseSeconds() != 1 {
+		t.Fatalf("expect lease of at least 1s, but got %d", cfg.leaseSeconds())
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, cfg := range []Config{
+		{DialTimeout: -time.Second},
+		{LeaseTTL: -time.Second},
+		{Prefix: "prod/geecache"},
+	} {
+		if cfg.Validate() == nil {
+			t.Errorf("%+v should be invalid", cfg)
+		}
+	}
+	if err := (Config{Prefix: "cluster-b", LeaseTTL: time.Minute}).Validate(); err != nil {
+		t.Errorf("valid config rejected: %v", err)
+	}
+}
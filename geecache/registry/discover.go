@@ -1,22 +1,100 @@
 package registry
 
 import (
+	"context"
+	"encoding/json"
+	"log"
+
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/naming/endpoints"
 	"go.etcd.io/etcd/client/v3/naming/resolver"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-// EtcdDial 向grpc请求一个服务，通过提供一个etcd client和service name即可获得Connection
-func EtcdDial(c *clientv3.Client, service string) (*grpc.ClientConn, error) {
+// EtcdDial 向grpc请求一个服务，通过提供一个etcd client、注册配置和服务地址即可获得Connection，服务名称为 <Prefix>/<addr>
+// 由于使用了 grpc.WithBlock()，建立连接的过程受 ctx 的超时与取消控制，opts 会追加到默认的连接选项之后，
+// 其中的 grpc.WithTransportCredentials 会覆盖默认的明文连接
+func EtcdDial(ctx context.Context, c *clientv3.Client, cfg Config, addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	etcdResolver, err := resolver.NewBuilder(c) //使用etcd客户端构建了一个服务发现的构建器。
 	if err != nil {                             //检查是否在创建etcd服务发现构建器时发生了错误
 		return nil, err
 	}
-	return grpc.Dial(
-		"etcd:///"+service,                                       //指定了服务的地址
+	dialOpts := []grpc.DialOption{
 		grpc.WithResolvers(etcdResolver),                         //用于服务发现的解析器
-		grpc.WithTransportCredentials(insecure.NewCredentials()), //用于设置gRPC连接的传输层安全性，这里使用了不安全的连接（insecure）
-		grpc.WithBlock(),                                         //用于在连接建立之前阻塞，确保连接建立成功后再继续执行后续的代码。
-	)
+		grpc.WithTransportCredentials(insecure.NewCredentials()), //用于设置gRPC连接的传输层安全性，默认使用不安全的连接（insecure）
+		grpc.WithBlock(), //用于在连接建立之前阻塞，确保连接建立成功后再继续执行后续的代码。
+	}
+	return grpc.DialContext(ctx, "etcd:///"+cfg.target(addr), append(dialOpts, opts...)...) //指定了服务的地址
 } // 最后返回一个指向已建立连接的grpc.ClientConn类型的指针，或者在发生错误时返回一个错误
+
+// Watch 监听 cfg.Service() 下所有服务节点的变化。返回的通道中第一批更新一定是当前完整的节点列表（可能为空），
+// 之后是增量的新增和删除。watch 失败或 ctx 被取消时关闭通道，调用方需要重新 Watch 并用新的完整列表覆盖旧的状态。
+func Watch(ctx context.Context, c *clientv3.Client, cfg Config) (endpoints.WatchChannel, error) {
+	prefix := cfg.Service() + "/"
+	resp, err := c.Get(ctx, prefix, clientv3.WithPrefix()) //先读取当前所有节点，作为第一批更新
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make([]*endpoints.Update, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if up, ok := decodeUpdate(cfg, endpoints.Add, string(kv.Key), kv.Value); ok {
+			snapshot = append(snapshot, up)
+		}
+	}
+
+	upch := make(chan []*endpoints.Update, 1)
+	upch <- snapshot
+	//从读取快照之后的版本开始监听，保证不会漏掉快照与监听之间的变化
+	wch := c.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+	go func() {
+		defer close(upch)
+		for wresp := range wch {
+			if err := wresp.Err(); err != nil {
+				log.Printf("watch %s failed: %v", prefix, err)
+				return
+			}
+			updates := make([]*endpoints.Update, 0, len(wresp.Events))
+			for _, e := range wresp.Events {
+				op := endpoints.Add
+				if e.Type == clientv3.EventTypeDelete {
+					op = endpoints.Delete
+				}
+				if up, ok := decodeUpdate(cfg, op, string(e.Kv.Key), e.Kv.Value); ok {
+					updates = append(updates, up)
+				}
+			}
+			select {
+			case upch <- updates:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return upch, nil
+}
+
+// decodeUpdate 将etcd中的一条记录解析为节点更新，记录的格式见 record。Endpoint.Addr 是从 key 中解析出的节点地址，
+// 删除事件中也有；新增事件的 Endpoint.Metadata 是 Metadata 类型，它可以比较，但只供 Watch 的调用方使用。
+// 不是节点的 key 会被忽略。旧版本把节点注册在 <Prefix>/<addr>，etcd的 resolver 找不到这样的节点，
+// 新版本也就无法连接它，因此同样忽略，并打印日志提醒不能与旧版本的节点混合部署
+func decodeUpdate(cfg Config, op endpoints.Operation, key string, value []byte) (*endpoints.Update, bool) {
+	addr, ok := cfg.Addr(key)
+	if !ok {
+		if legacy, ok := cfg.legacyAddr(key); ok && op == endpoints.Add {
+			log.Printf("ignore node %s registered by an older version at %s, upgrade all nodes together or use a new prefix", legacy, key)
+		}
+		return nil, false
+	}
+	up := &endpoints.Update{Op: op, Key: key, Endpoint: endpoints.Endpoint{Addr: addr}}
+	if op == endpoints.Delete { //删除事件中没有value
+		return up, true
+	}
+	var r record
+	if err := json.Unmarshal(value, &r); err != nil {
+		log.Printf("decode endpoint %s failed: %v", key, err)
+		return nil, false
+	}
+	up.Endpoint.Metadata = r.Node
+	return up, true
+}
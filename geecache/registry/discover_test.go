@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"Geecache/geecache/registry/etcdtest"
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/naming/endpoints"
+)
+
+// register 通过 Register 注册节点，等到记录写入后返回注销函数
+func register(t *testing.T, etcd *etcdtest.Server, cfg Config, addr string, weight int) (deregister func()) {
+	t.Helper()
+	stop, done := make(chan error), make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := Register(cfg, addr, Metadata{Weight: weight}, stop); err != nil {
+			t.Error(err)
+		}
+	}()
+	for i := 0; ; i++ {
+		if _, ok := etcd.Get(cfg.Key(addr)); ok {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("%s is not registered", addr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// next 读取下一批更新，只保留 Op、地址和节点信息
+func next(t *testing.T, wc endpoints.WatchChannel) []endpoints.Update {
+	t.Helper()
+	select {
+	case ups, ok := <-wc:
+		if !ok {
+			t.Fatalf("watch channel closed")
+		}
+		got := make([]endpoints.Update, 0, len(ups))
+		for _, up := range ups {
+			got = append(got, endpoints.Update{Op: up.Op, Endpoint: up.Endpoint})
+		}
+		return got
+	case <-time.After(time.Second):
+		t.Fatalf("no update received")
+	}
+	return nil
+}
+
+// 测试 Watch 通过etcd的 Get 和 Watch 返回完整的节点列表和增量更新，并且只解析当前前缀下的节点
+func TestWatch(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	etcd := etcdtest.New()
+	cfg := Config{Prefix: "cluster-a", Dial: etcd.Dial}
+	defer register(t, etcd, cfg, "127.0.0.1:8001", 2)()
+	defer register(t, etcd, Config{Prefix: "cluster-aa", Dial: etcd.Dial}, "127.0.0.1:9001", 1)()
+	etcd.Put("cluster-a/127.0.0.1:9002", `{"Op":0,"Addr":"127.0.0.1:9002","Metadata":{"weight":1}}`) //旧版本的 key
+
+	cli, _ := cfg.NewClient()
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	wc, err := Watch(ctx, cli, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func(addr string, weight int) endpoints.Update {
+		return endpoints.Update{Op: endpoints.Add, Endpoint: endpoints.Endpoint{Addr: addr, Metadata: Metadata{Weight: weight}}}
+	}
+	if got, expect := next(t, wc), []endpoints.Update{add("127.0.0.1:8001", 2)}; !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect snapshot %+v, but got %+v", expect, got)
+	}
+	if !strings.Contains(logs.String(), "127.0.0.1:9002 registered by an older version") {
+		t.Fatalf("node registered by an older version should be reported")
+	}
+
+	deregister := register(t, etcd, cfg, "127.0.0.1:8002", 3)
+	if got, expect := next(t, wc), []endpoints.Update{add("127.0.0.1:8002", 3)}; !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect %+v, but got %+v", expect, got)
+	}
+	deregister() //租约失效，etcd 删除节点的 key
+	expect := []endpoints.Update{{Op: endpoints.Delete, Endpoint: endpoints.Endpoint{Addr: "127.0.0.1:8002"}}}
+	if got := next(t, wc); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect %+v, but got %+v", expect, got)
+	}
+
+	cancel()
+	for range wc { //ctx 被取消后关闭通道
+	}
+}
+
+// 测试节点在etcd中的记录可以被etcd的 resolver 解析，并且 Metadata 为空
+func TestRecordCompatible(t *testing.T) {
+	etcd := etcdtest.New()
+	cfg := Config{Dial: etcd.Dial}
+	defer register(t, etcd, cfg, "127.0.0.1:8001", 2)()
+	cli, _ := cfg.NewClient()
+	defer cli.Close()
+	em, err := endpoints.NewManager(cli, cfg.target("127.0.0.1:8001"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eps, err := em.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := endpoints.Key2EndpointMap{cfg.Key("127.0.0.1:8001"): {Addr: "127.0.0.1:8001"}}
+	if !reflect.DeepEqual(eps, expect) {
+		t.Fatalf("expect endpoints %+v, but got %+v", expect, eps)
+	}
+}
@@ -0,0 +1,331 @@
+package etcdtest // Package etcdtest 提供进程内的etcd替身，实现了 registry 以及etcd的 naming resolver 用到的 KV、Watch 和租约接口
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+/*
+Server 是一个只保存在内存中的etcd，包含以下状态：
+当前版本号 rev，每次写入或删除加 1；
+当前所有的键值对 kvs；
+每个租约上的 key，租约被撤销或者创建它的客户端关闭时，这些 key 会被删除，模拟节点退出后租约到期；
+所有的变化 events，用于从指定的版本号开始 Watch；
+changed 在每次变化后被关闭并替换，用于通知正在 Watch 的协程。
+租约不会因为时间而过期，未实现的接口（例如 Txn、Compact）被调用时会 panic。
+*/
+type Server struct {
+	mu        sync.Mutex
+	rev       int64
+	kvs       map[string]*mvccpb.KeyValue
+	leases    map[clientv3.LeaseID]map[string]bool
+	nextLease clientv3.LeaseID
+	events    []*clientv3.Event
+	changed   chan struct{}
+}
+
+// New 创建一个空的 Server
+func New() *Server {
+	return &Server{
+		kvs:     make(map[string]*mvccpb.KeyValue),
+		leases:  make(map[clientv3.LeaseID]map[string]bool),
+		changed: make(chan struct{}),
+	}
+}
+
+// Client 返回访问 s 的etcd客户端，客户端关闭时，通过它创建的租约全部失效
+func (s *Server) Client() *clientv3.Client {
+	cli := clientv3.NewCtxClient(context.Background())
+	cli.KV = &kv{s: s}
+	cli.Watcher = &watcher{s: s, done: make(chan struct{})}
+	cli.Lease = &lease{s: s, done: make(chan struct{})}
+	return cli
+}
+
+// Dial 与 clientv3.New 的签名相同，可以作为 registry.Config.Dial，忽略 cfg 中的地址等配置
+func (s *Server) Dial(cfg clientv3.Config) (*clientv3.Client, error) {
+	return s.Client(), nil
+}
+
+// Put 写入一个不属于任何租约的键值对
+func (s *Server) Put(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putLocked(key, value, clientv3.NoLease)
+}
+
+// Delete 删除 key，key 不存在时什么也不做
+func (s *Server) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteLocked(key)
+}
+
+// Get 返回 key 当前的值
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if kv, ok := s.kvs[key]; ok {
+		return string(kv.Value), true
+	}
+	return "", false
+}
+
+// Keys 返回以 prefix 开头的所有 key，按字典序排列
+func (s *Server) Keys(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.kvs {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) putLocked(key, value string, id clientv3.LeaseID) {
+	s.rev++
+	kv := &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value), ModRevision: s.rev, Version: 1, Lease: int64(id)}
+	if old, ok := s.kvs[key]; ok {
+		kv.CreateRevision, kv.Version = old.CreateRevision, old.Version+1
+		delete(s.leases[clientv3.LeaseID(old.Lease)], key)
+	} else {
+		kv.CreateRevision = s.rev
+	}
+	s.kvs[key] = kv
+	if id != clientv3.NoLease {
+		s.leases[id][key] = true
+	}
+	s.notifyLocked(&clientv3.Event{Type: mvccpb.PUT, Kv: kv})
+}
+
+func (s *Server) deleteLocked(key string) {
+	old, ok := s.kvs[key]
+	if !ok {
+		return
+	}
+	s.rev++
+	delete(s.kvs, key)
+	delete(s.leases[clientv3.LeaseID(old.Lease)], key)
+	s.notifyLocked(&clientv3.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte(key), ModRevision: s.rev}})
+}
+
+// revokeLocked 撤销租约并删除租约上的所有 key
+func (s *Server) revokeLocked(id clientv3.LeaseID) {
+	keys, ok := s.leases[id]
+	if !ok {
+		return
+	}
+	for key := range keys {
+		s.deleteLocked(key)
+	}
+	delete(s.leases, id)
+	s.notifyLocked(nil) //通知 KeepAlive 租约已经失效
+}
+
+func (s *Server) notifyLocked(e *clientv3.Event) {
+	if e != nil {
+		s.events = append(s.events, e)
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) header() *pb.ResponseHeader {
+	return &pb.ResponseHeader{Revision: s.rev}
+}
+
+// inRange 判断 key 是否在 op 指定的范围内：没有 end 时只匹配 key 本身，end 为 "\x00" 时匹配所有不小于 key 的 key
+func inRange(key string, op clientv3.Op) bool {
+	start, end := string(op.KeyBytes()), string(op.RangeBytes())
+	switch end {
+	case "":
+		return key == start
+	case "\x00":
+		return key >= start
+	}
+	return key >= start && key < end
+}
+
+// kv 实现 Get、Put 和 Delete，其余方法由内嵌的 nil 接口提供，调用时会 panic
+type kv struct {
+	clientv3.KV
+	s *Server
+}
+
+func (k *kv) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	op := clientv3.OpPut(key, val, opts...)
+	//Op 没有导出租约 ID，只能通过反射读取
+	id := clientv3.LeaseID(reflect.ValueOf(op).FieldByName("leaseID").Int())
+	k.s.mu.Lock()
+	defer k.s.mu.Unlock()
+	if _, ok := k.s.leases[id]; id != clientv3.NoLease && !ok {
+		return nil, context.DeadlineExceeded
+	}
+	k.s.putLocked(key, val, id)
+	return &clientv3.PutResponse{Header: k.s.header()}, nil
+}
+
+func (k *kv) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	op := clientv3.OpGet(key, opts...)
+	k.s.mu.Lock()
+	defer k.s.mu.Unlock()
+	resp := &clientv3.GetResponse{Header: k.s.header()}
+	for name, kv := range k.s.kvs {
+		if inRange(name, op) {
+			resp.Kvs = append(resp.Kvs, kv)
+		}
+	}
+	sort.Slice(resp.Kvs, func(i, j int) bool { return string(resp.Kvs[i].Key) < string(resp.Kvs[j].Key) })
+	resp.Count = int64(len(resp.Kvs))
+	return resp, nil
+}
+
+func (k *kv) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	op := clientv3.OpDelete(key, opts...)
+	k.s.mu.Lock()
+	defer k.s.mu.Unlock()
+	var deleted int64
+	for name := range k.s.kvs {
+		if inRange(name, op) {
+			k.s.deleteLocked(name)
+			deleted++
+		}
+	}
+	return &clientv3.DeleteResponse{Header: k.s.header(), Deleted: deleted}, nil
+}
+
+// watcher 从指定的版本号开始推送变化，没有指定版本号时从当前版本之后开始
+type watcher struct {
+	clientv3.Watcher
+	s    *Server
+	once sync.Once
+	done chan struct{}
+}
+
+func (w *watcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	op := clientv3.OpGet(key, opts...)
+	w.s.mu.Lock()
+	next := op.Rev()
+	if next == 0 {
+		next = w.s.rev + 1
+	}
+	w.s.mu.Unlock()
+	ch := make(chan clientv3.WatchResponse)
+	go func() {
+		defer close(ch)
+		for {
+			w.s.mu.Lock()
+			resp := clientv3.WatchResponse{Header: *w.s.header()}
+			for _, e := range w.s.events {
+				if e.Kv.ModRevision >= next && inRange(string(e.Kv.Key), op) {
+					resp.Events = append(resp.Events, e)
+				}
+			}
+			next = w.s.rev + 1
+			changed := w.s.changed
+			w.s.mu.Unlock()
+			if len(resp.Events) > 0 {
+				select {
+				case ch <- resp:
+				case <-ctx.Done():
+					return
+				case <-w.done:
+					return
+				}
+			}
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func (w *watcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	return nil
+}
+
+// lease 记录通过它创建的租约，Close 时撤销这些租约
+type lease struct {
+	clientv3.Lease
+	s       *Server
+	mu      sync.Mutex
+	granted []clientv3.LeaseID
+	once    sync.Once
+	done    chan struct{}
+}
+
+func (l *lease) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	l.s.mu.Lock()
+	l.s.nextLease++
+	id := l.s.nextLease
+	l.s.leases[id] = make(map[string]bool)
+	l.s.mu.Unlock()
+	l.mu.Lock()
+	l.granted = append(l.granted, id)
+	l.mu.Unlock()
+	return &clientv3.LeaseGrantResponse{ID: id, TTL: ttl}, nil
+}
+
+func (l *lease) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+	l.s.revokeLocked(id)
+	return &clientv3.LeaseRevokeResponse{Header: l.s.header()}, nil
+}
+
+// KeepAlive 立即返回一次续约结果，通道在租约失效、ctx 被取消或者客户端关闭时关闭
+func (l *lease) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ch := make(chan *clientv3.LeaseKeepAliveResponse, 1)
+	ch <- &clientv3.LeaseKeepAliveResponse{ID: id}
+	go func() {
+		defer close(ch)
+		for {
+			l.s.mu.Lock()
+			_, alive := l.s.leases[id]
+			changed := l.s.changed
+			l.s.mu.Unlock()
+			if !alive {
+				return
+			}
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			case <-l.done:
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (l *lease) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+		l.mu.Lock()
+		granted := l.granted
+		l.mu.Unlock()
+		l.s.mu.Lock()
+		defer l.s.mu.Unlock()
+		for _, id := range granted {
+			l.s.revokeLocked(id)
+		}
+	})
+	return nil
+}
@@ -2,51 +2,60 @@ package registry // Package registry模块提供服务Service注册至etcd的能
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/naming/endpoints"
 	"log"
-	"time"
 )
 
-var (
-	//这个变量通常用于创建etcd客户端的配置，当你不需要定制化的配置时，可以直接使用 defaultEtcdConfig 这个预定义的配置。
-	defaultEtcdConfig = clientv3.Config{
-		Endpoints:   []string{"localhost:2379"}, // etcd服务器的地址，这里使用本地地址和默认端口
-		DialTimeout: 5 * time.Second,            // 建立连接的超时时间为5秒
-	}
-)
+// Metadata 是服务节点注册至etcd时附带的信息，其他节点通过 Watch 获取
+type Metadata struct {
+	Weight int `json:"weight"` // 节点的权重，决定节点在一致性哈希环上的虚拟节点数量
+}
+
+// record 是节点在etcd中的记录，格式与 endpoints.Manager 写入的一致，etcd的 resolver 可以直接解析出 Addr。
+// 节点信息写在 resolver 不认识的 node 字段中，不写入 Metadata 字段：resolver 会把 Metadata 原样放进 resolver.Address，
+// JSON 解析出的 map 不能用 == 比较，节点重新注册时 gRPC 比较新旧地址会 panic
+type record struct {
+	Op   endpoints.Operation
+	Addr string
+	Node Metadata `json:"node"`
+}
 
 // etcdAdd 在租赁模式添加一对kv至etcd
-// 四个参数分别是etcd客户端，etcd租约ID，服务名称，服务地址
-func etcdAdd(c *clientv3.Client, lid clientv3.LeaseID, service string, addr string) error {
-	em, err := endpoints.NewManager(c, service) //创建一个用于管理 etcd 中的服务端点（endpoints）
+// 五个参数分别是etcd客户端，etcd租约ID，注册配置，服务地址，节点信息
+func etcdAdd(c *clientv3.Client, lid clientv3.LeaseID, cfg Config, addr string, meta Metadata) error {
+	value, err := json.Marshal(record{Op: endpoints.Add, Addr: addr, Node: meta})
 	if err != nil {
 		return err
 	}
-	//该方法用于将指定的服务地址（addr）添加到 etcd 中的服务端点列表中。
 	//clientv3.WithLease(lid) 选项表示使用指定的租约 ID（lid）来设置键值的生命周期。
-	//如果添加服务地址成功，函数会返回 nil 表示没有错误；如果发生错误，函数会返回相应的错误信息
-	return em.AddEndpoint(c.Ctx(), service+"/"+addr, endpoints.Endpoint{Addr: addr}, clientv3.WithLease(lid))
+	_, err = c.Put(c.Ctx(), cfg.Key(addr), string(value), clientv3.WithLease(lid))
+	return err
 }
 
 // Register 注册一个服务至etcd,并且在服务的生命周期内保持心跳检测，确保服务的持续在线。
+// 服务地址 addr 注册在 cfg.Key(addr) 下，meta 会随服务地址一起写入etcd
 // 注意 Register将不会return 如果没有error的话
-func Register(service string, addr string, stop chan error) error {
+func Register(cfg Config, addr string, meta Metadata, stop chan error) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
 	// 创建一个etcd client
-	cli, err := clientv3.New(defaultEtcdConfig)
+	cli, err := cfg.NewClient()
 	if err != nil {
 		return fmt.Errorf("create etcd client failed: %v", err)
 	}
 	defer cli.Close()
-	// 创建一个租约 配置5秒过期
-	resp, err := cli.Grant(context.Background(), 5)
+	// 创建一个租约 按 cfg.LeaseTTL 过期，默认5秒
+	resp, err := cli.Grant(context.Background(), cfg.leaseSeconds())
 	if err != nil {
 		return fmt.Errorf("create lease failed: %v", err)
 	}
 	leaseId := resp.ID //获取了该租约的 ID
 	// 注册服务
-	err = etcdAdd(cli, leaseId, service, addr)
+	err = etcdAdd(cli, leaseId, cfg, addr, meta)
 	if err != nil {
 		return fmt.Errorf("add etcd record failed: %v", err)
 	}
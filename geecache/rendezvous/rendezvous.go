@@ -0,0 +1,141 @@
+package rendezvous
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+type Hash func(data []byte) uint64 //定义了函数类型 Hash，允许替换成自定义的 Hash 函数，默认为 64 位的 FNV-1a 算法。
+
+/*
+Rendezvous 实现了最高随机权重（Highest Random Weight, HRW）哈希，也称为汇合哈希：
+对于每个 key，计算它与每个节点组合后的得分，得分最高的节点负责该 key。
+节点加入时只有被新节点抢走的 key 会移动，节点离开时只有该节点的 key 会移动，且不需要虚拟节点就能均匀分布。
+代价是每次 Get 都要遍历所有节点，时间复杂度为 O(n)，适合节点数量不多的集群。
+hash：哈希函数；
+nodes：所有节点的名称，按名称排序；
+nodeHash：每个节点名称的哈希值，与 nodes 一一对应；
+weights：每个节点的权重，得分使用加权公式 -weight/ln(u) 计算，使节点分到的 key 的比例与权重成正比。
+*/
+type Rendezvous struct {
+	hash     Hash
+	nodes    []string
+	nodeHash []uint64
+	weights  []float64
+}
+
+// New 函数通过传入的哈希函数fn，返回一个 Rendezvous 结构体。
+func New(fn Hash) *Rendezvous {
+	r := &Rendezvous{hash: fn}
+	if r.hash == nil {
+		r.hash = fnv64a
+	}
+	return r
+}
+
+// Add 函数添加 0 或多个权重为 1 的节点，已经存在的节点会被忽略。
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		r.AddWeighted(node, 1)
+	}
+}
+
+// AddWeighted 函数添加一个带权重的节点，weight 小于 1 时按 1 处理，已经存在的节点会被忽略。
+func (r *Rendezvous) AddWeighted(node string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	idx := sort.SearchStrings(r.nodes, node)
+	if idx < len(r.nodes) && r.nodes[idx] == node {
+		return
+	}
+	r.nodes = append(r.nodes, "")
+	copy(r.nodes[idx+1:], r.nodes[idx:])
+	r.nodes[idx] = node
+	r.nodeHash = append(r.nodeHash, 0)
+	copy(r.nodeHash[idx+1:], r.nodeHash[idx:])
+	r.nodeHash[idx] = r.hash([]byte(node))
+	r.weights = append(r.weights, 0)
+	copy(r.weights[idx+1:], r.weights[idx:])
+	r.weights[idx] = float64(weight)
+}
+
+// Remove 函数删除传入的节点，不存在的节点会被忽略。
+func (r *Rendezvous) Remove(nodes ...string) {
+	for _, node := range nodes {
+		idx := sort.SearchStrings(r.nodes, node)
+		if idx == len(r.nodes) || r.nodes[idx] != node {
+			continue
+		}
+		r.nodes = append(r.nodes[:idx], r.nodes[idx+1:]...)
+		r.nodeHash = append(r.nodeHash[:idx], r.nodeHash[idx+1:]...)
+		r.weights = append(r.weights[:idx], r.weights[idx+1:]...)
+	}
+}
+
+// Members 函数返回当前所有节点的名称，按名称排序。
+func (r *Rendezvous) Members() []string {
+	return append([]string(nil), r.nodes...)
+}
+
+// Get 函数返回得分最高的节点，没有节点时返回空字符串。
+func (r *Rendezvous) Get(key string) string {
+	keyHash := r.hash([]byte(key))
+	best, bestScore := "", math.Inf(-1)
+	for i, node := range r.nodes {
+		if score := r.score(keyHash, i); score > bestScore {
+			best, bestScore = node, score
+		}
+	}
+	return best
+}
+
+// GetN 函数按得分从高到低返回前 n 个节点，第一个与 Get 的结果相同。节点数量不足 n 时返回所有节点。
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if n <= 0 || len(r.nodes) == 0 {
+		return nil
+	}
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+	keyHash := r.hash([]byte(key))
+	idx := make([]int, len(r.nodes))
+	scores := make([]float64, len(r.nodes))
+	for i := range r.nodes {
+		idx[i] = i
+		scores[i] = r.score(keyHash, i)
+	}
+	sort.Slice(idx, func(a, b int) bool {
+		return scores[idx[a]] > scores[idx[b]]
+	})
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = r.nodes[idx[i]]
+	}
+	return nodes
+}
+
+// score 函数计算 key 与第 i 个节点组合后的得分。
+// 先把两个哈希值混合成 (0,1) 之间均匀分布的 u，再用加权公式 -weight/ln(u) 计算得分。
+func (r *Rendezvous) score(keyHash uint64, i int) float64 {
+	u := (float64(mix(keyHash^r.nodeHash[i])>>11) + 0.5) / (1 << 53)
+	return -r.weights[i] / math.Log(u)
+}
+
+// mix 函数是 SplitMix64 的混合步骤，使相近的输入得到差异很大的输出。
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// fnv64a 函数是默认的哈希函数。
+func fnv64a(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
@@ -0,0 +1,80 @@
+package rendezvous
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	r := New(nil)
+	if r.Get("key") != "" {
+		t.Fatalf("empty Rendezvous should return empty node")
+	}
+	r.Add("a", "b", "c")
+	owners := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = r.Get(key)
+	}
+	// 添加节点后，key 要么保持原来的拥有者，要么移动到新节点
+	r.Add("d")
+	moved := 0
+	for key, owner := range owners {
+		if now := r.Get(key); now != owner {
+			if now != "d" {
+				t.Fatalf("key %s should move to d or stay on %s, but got %s", key, owner, now)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 400 {
+		t.Fatalf("about 1/4 keys should move to d, but %d moved", moved)
+	}
+	// 删除节点后，其他节点的 key 不受影响
+	r.Remove("d", "unknown")
+	for key, owner := range owners {
+		if now := r.Get(key); now != owner {
+			t.Fatalf("key %s should go back to %s, but got %s", key, owner, now)
+		}
+	}
+	if members := r.Members(); !reflect.DeepEqual(members, []string{"a", "b", "c"}) {
+		t.Fatalf("Members should be [a b c], but got %v", members)
+	}
+}
+
+func TestGetN(t *testing.T) {
+	r := New(nil)
+	r.Add("a", "b", "c", "d")
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		nodes := r.GetN(key, 3)
+		if len(nodes) != 3 || nodes[0] != r.Get(key) {
+			t.Fatalf("GetN(%s, 3) = %v, first should be %s", key, nodes, r.Get(key))
+		}
+		// 删除第一个节点后，原来的第二个节点成为新的拥有者
+		r.Remove(nodes[0])
+		if owner := r.Get(key); owner != nodes[1] {
+			t.Fatalf("%s should own %s after removing %s, but got %s", nodes[1], key, nodes[0], owner)
+		}
+		r.Add(nodes[0])
+	}
+	if nodes := r.GetN("key", 10); len(nodes) != 4 {
+		t.Fatalf("GetN should return all 4 nodes, but got %v", nodes)
+	}
+}
+
+func TestAddWeighted(t *testing.T) {
+	r := New(nil)
+	r.AddWeighted("a", 1)
+	r.AddWeighted("b", 3)
+	count := make(map[string]int)
+	const total = 100000
+	for i := 0; i < total; i++ {
+		count[r.Get("key"+strconv.Itoa(i))]++
+	}
+	if share := float64(count["b"]) / total; math.Abs(share-0.75) > 0.02 {
+		t.Fatalf("b should own about 75%% keys, but got %.2f%%", share*100)
+	}
+}
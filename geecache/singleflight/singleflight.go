@@ -1,11 +1,17 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
-type call struct { //call 代表正在进行中，或已经结束的请求。使用 sync.WaitGroup 锁避免重入。
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+type call struct { //call 代表正在进行中，或已经结束的请求。使用 done 通道通知等待者，避免重入。
+	done    chan struct{}
+	val     interface{}
+	err     error
+	ctx     *flightContext //fn 使用的 ctx
+	waiters int            //还在等待结果的调用方数量，由 Group.mu 保护
 }
 
 type Group struct { //Group 是 singleflight 的主数据结构，管理不同 key 的请求(call).
@@ -13,29 +19,128 @@ type Group struct { //Group 是 singleflight 的主数据结构，管理不同 k
 	m  map[string]*call
 }
 
+// Do 等价于不带超时的 DoContext
 func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	return g.DoContext(context.Background(), key, func(context.Context) (interface{}, error) {
+		return fn()
+	})
+}
+
+/*
+DoContext 在 Do 的基础上支持 context：fn 在单独的协程中执行，所有调用方（包括发起请求的第一个）都只是等待者，
+在 ctx 被取消或超时时立即返回 ctx.Err()。fn 不会因为某个调用方放弃而被打断，它的结果仍会交给其他未取消的等待者。
+fn 的 ctx 由所有等待者共同决定：截止时间是等待者中最晚的截止时间，有等待者没有截止时间时则没有截止时间；
+最后一个等待者放弃时 ctx 被取消，之后的调用方会发起新的请求；Value 来自发起请求的调用方。
+ctx 在调用前已经结束时不会发起新的请求。
+*/
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	g.mu.Lock()
 	if g.m == nil {
 		g.m = make(map[string]*call)
 	}
-	if c, ok := g.m[key]; ok {
-		g.mu.Unlock()
-		c.wg.Wait()         // 如果请求正在进行中，则等待
-		return c.val, c.err // 请求结束，返回结果
+	c, ok := g.m[key]
+	if !ok { // 没有进行中的请求，发起请求
+		c = &call{done: make(chan struct{}), ctx: newFlightContext(ctx)}
+		g.m[key] = c // 添加到 g.m，表明 key 已经有对应的请求在处理
+	}
+	c.waiters++
+	c.ctx.join(ctx) //在 fn 开始之前加入，使 fn 看到第一个调用方的截止时间
+	if !ok {
+		go g.run(key, c, fn)
 	}
-	c := new(call)
-	c.wg.Add(1)  // 发起请求前加锁
-	g.m[key] = c // 添加到 g.m，表明 key 已经有对应的请求在处理
 	g.mu.Unlock()
 
-	c.val, c.err = fn() // 调用 fn，发起请求
-	c.wg.Done()         // 请求结束
+	select {
+	case <-c.done: // 等待请求结束
+		return c.val, c.err // 返回结果
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 { //没有人再等待结果，取消 fn，并让之后的调用方发起新的请求
+			c.ctx.cancel(ctx.Err())
+			if g.m[key] == c {
+				delete(g.m, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// run 调用 fn 发起请求，结束后唤醒所有等待者
+func (g *Group) run(key string, c *call, fn func(ctx context.Context) (interface{}, error)) {
+	c.val, c.err = fn(c.ctx) // 调用 fn，发起请求
+	close(c.done)            // 请求结束
 
 	g.mu.Lock()
-	delete(g.m, key) // 更新 g.m
+	if g.m[key] == c { // 更新 g.m，所有等待者都已经放弃时 key 可能已经有了新的请求
+		delete(g.m, key)
+	}
 	g.mu.Unlock()
+	c.ctx.cancel(context.Canceled) //释放 fn 派生的 ctx
+}
+
+// flightContext 是 fn 使用的 context，截止时间随等待者的加入而延长，最后一个等待者放弃时被取消
+type flightContext struct {
+	values    context.Context //发起请求的调用方的 ctx，只用于读取值
+	done      chan struct{}
+	mu        sync.Mutex
+	deadline  time.Time
+	unbounded bool //有等待者没有截止时间
+	err       error
+}
+
+func newFlightContext(values context.Context) *flightContext {
+	return &flightContext{values: values, done: make(chan struct{})}
+}
+
+// join 根据新的等待者的截止时间延长截止时间。已经派生出的 ctx（例如已经发出的 gRPC 请求）仍然使用原来的截止时间
+func (c *flightContext) join(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		c.unbounded = true
+	} else if deadline.After(c.deadline) {
+		c.deadline = deadline
+	}
+}
+
+func (c *flightContext) cancel(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+	}
+}
+
+func (c *flightContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.unbounded {
+		return time.Time{}, false
+	}
+	return c.deadline, true
+}
+
+func (c *flightContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *flightContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *flightContext) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
 
-	return c.val, c.err // 返回结果
-} //实现了singleFlight原理：在多个并发请求触发的回调操作里，只有第⼀个回调方法被执行，
+//实现了singleFlight原理：在多个并发请求触发的回调操作里，只有第⼀个回调方法被执行，
 // 其余请求（落在第⼀个回调方法执行的时间窗口里）阻塞等待第⼀个回调函数执行完成后直接取结果，
 //以此保证同⼀时刻只有⼀个回调方法执行，达到防止缓存击穿的目的。
@@ -1,6 +1,10 @@
 package singleflight
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+)
 
 func TestDo(t *testing.T) {
 	var g Group
@@ -11,3 +15,107 @@ func TestDo(t *testing.T) {
 		t.Errorf("Do v = %v,error = %v", v, err)
 	}
 }
+
+func TestDoContextCancel(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go g.Do("key", func() (interface{}, error) {
+		close(started)
+		<-release
+		return "bar", nil
+	})
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.DoContext(ctx, "key", func(context.Context) (interface{}, error) {
+		return "baz", nil
+	}); err != context.DeadlineExceeded {
+		t.Errorf("DoContext error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+}
+
+// 发起请求的调用方取消后，fn 继续执行，其他等待者仍然拿到结果
+func TestDoContextLeaderCancel(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := g.DoContext(ctx, "key", func(context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return "bar", nil
+		})
+		leader <- err
+	}()
+	<-started
+	follower := make(chan interface{}, 1)
+	go func() {
+		v, _ := g.DoContext(context.Background(), "key", func(context.Context) (interface{}, error) {
+			return "baz", nil
+		})
+		follower <- v
+	}()
+	time.Sleep(10 * time.Millisecond) //等待 follower 加入同一个请求
+	cancel()
+	if err := <-leader; err != context.Canceled {
+		t.Fatalf("leader error = %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if v := <-follower; v != "bar" {
+		t.Errorf("follower v = %v, want bar", v)
+	}
+}
+
+// fn 的截止时间是等待者中最晚的截止时间，所有等待者都放弃后 fn 的 ctx 被取消，之后的调用方发起新的请求
+func TestDoContextWaiters(t *testing.T) {
+	var g Group
+	deadlines := make(chan time.Time, 2)
+	fnErr := make(chan error, 1)
+	started := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		time.Sleep(20 * time.Millisecond) //等待第二个调用方加入
+		deadline, _ := ctx.Deadline()
+		deadlines <- deadline
+		<-ctx.Done()
+		fnErr <- ctx.Err()
+		return nil, ctx.Err()
+	}
+	short, cancel1 := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel1()
+	long, cancel2 := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel2()
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.DoContext(short, "key", fn)
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, err := g.DoContext(long, "key", fn)
+		errs <- err
+	}()
+	if deadline, _ := long.Deadline(); !(<-deadlines).Equal(deadline) {
+		t.Fatalf("fn should see the latest deadline of the waiters")
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != context.DeadlineExceeded {
+			t.Fatalf("DoContext error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	}
+	select {
+	case err := <-fnErr:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("fn ctx error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("fn ctx should be cancelled after all waiters leave")
+	}
+	if v, err := g.Do("key", func() (interface{}, error) { return "bar", nil }); v != "bar" || err != nil {
+		t.Errorf("Do v = %v, error = %v", v, err)
+	}
+}
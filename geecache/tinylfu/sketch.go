@@ -0,0 +1,100 @@
+package tinylfu
+
+import "hash/fnv"
+
+const (
+	sketchDepth  = 4  //count-min sketch 的行数，每个 key 在每一行对应一个计数器
+	maxCounter   = 15 //计数器的上限，与 4 位计数器相同，频率再高也不会影响准入的判断
+	resetPerSlot = 10 //计数次数达到计数器数量的 10 倍时，所有计数器减半
+)
+
+/*
+sketch 是 count-min sketch，用很少的内存近似地统计每个 key 最近的访问频率：
+每个 key 在 sketchDepth 行中各对应一个计数器，访问时全部加一，估计频率时取其中的最小值，
+哈希冲突只会让估计值偏大而不会偏小。
+计数次数达到 sampleSize 时，所有计数器减半（衰减），使很久以前的热点 key 的频率逐渐降低，可以被新的热点替换。
+*/
+type sketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+// newSketch 创建一个每行有 width 个计数器的 sketch，width 会被向上取整为 2 的幂
+func newSketch(width int) *sketch {
+	w := 1
+	for w < width {
+		w <<= 1
+	}
+	s := &sketch{mask: uint64(w - 1), sampleSize: w * resetPerSlot}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+// index 返回 key 在第 i 行对应的计数器下标，使用双重哈希由一个 64 位哈希值得到每一行的下标
+func (s *sketch) index(h uint64, i int) uint64 {
+	h1, h2 := h, (h>>32)|1
+	return (h1 + uint64(i)*h2) & s.mask
+}
+
+// increment 将 key 的频率加一，达到采样数量时衰减
+func (s *sketch) increment(key string) {
+	h := hash(key)
+	for i := range s.rows {
+		if idx := s.index(h, i); s.rows[i][idx] < maxCounter {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// estimate 返回 key 的估计频率
+func (s *sketch) estimate(key string) uint8 {
+	h := hash(key)
+	min := uint8(maxCounter)
+	for i := range s.rows {
+		if c := s.rows[i][s.index(h, i)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// reset 将所有计数器减半
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+// clear 将所有计数器清零
+func (s *sketch) clear() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = 0
+		}
+	}
+	s.additions = 0
+}
+
+// hash 计算 key 的 64 位 FNV-1a 哈希值，再经过 SplitMix64 的混合步骤使高位和低位都足够随机
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,251 @@
+package tinylfu
+
+import (
+	"container/list"
+	"time"
+)
+
+const (
+	windowPercent    = 1  //窗口区域占总容量的百分比
+	protectedPercent = 80 //保护区域占主区域容量的百分比
+	avgEntryBytes    = 64 //估计的平均记录大小，用于根据容量确定 sketch 的大小
+	minSketchWidth   = 256
+	maxSketchWidth   = 1 << 20
+)
+
+// 记录所在的区域
+const (
+	windowRegion = iota
+	probationRegion
+	protectedRegion
+)
+
+/*
+TinyLFU 实现了 W-TinyLFU 缓存淘汰算法，容量按字节计算：
+window：窗口区域，是一个占总容量 1% 的 LRU，新记录先进入这里，使突发的新 key 有机会积累访问频率；
+probation、protected：主区域，是一个分段 LRU（SLRU）。从窗口淘汰的记录进入 probation，在 probation 中再次被访问后升级到 protected，
+protected 占主区域的 80%，超出时最久未使用的记录降级回 probation；
+sketch：count-min sketch，近似地记录每个 key 最近的访问频率，并周期性地减半，使过去的热点逐渐冷却；
+窗口区域满了之后，最久未使用的记录（候选者）需要与主区域中将被淘汰的记录（受害者）比较访问频率，频率更高的一方留下，
+这样一次性扫描大量冷 key 不会把热点 key 挤出缓存。
+cache：map，键是字符串，值是所在链表中对应节点的指针；
+OnEvicted：是某条记录被移除时的回调函数，可以为 nil。
+*/
+type TinyLFU struct {
+	maxBytes       int64
+	nBytes         int64
+	windowMax      int64
+	mainMax        int64
+	protectedMax   int64
+	windowBytes    int64
+	probationBytes int64
+	protectedBytes int64
+	window         *list.List
+	probation      *list.List
+	protected      *list.List
+	cache          map[string]*list.Element
+	sketch         *sketch
+	OnEvicted      func(key string, value Value)
+}
+
+type Value interface {
+	Len() int
+} // 为了通用性，我们允许值是实现了 Value 接口的任意类型，该接口只包含了一个方法 Len() int，用于返回值所占用的内存大小。
+
+type entry struct {
+	key    string
+	value  Value
+	expire time.Time //节点的过期时间
+	region int       //节点所在的区域
+}
+
+// size 返回记录占用的容量
+func (e *entry) size() int64 {
+	return int64(len(e.key)) + int64(e.value.Len())
+}
+
+// New 通过传入maxBytes,onEvicted这些参数，返回一个TinyLFU结构体。maxBytes 为 0 时不限制容量，也不会淘汰任何记录。
+func New(maxBytes int64, onEvicted func(string, Value)) *TinyLFU {
+	width := int(maxBytes / avgEntryBytes)
+	if width < minSketchWidth || maxBytes == 0 { //不限制容量时不会淘汰记录，sketch 只需要最小的大小
+		width = minSketchWidth
+	}
+	if width > maxSketchWidth {
+		width = maxSketchWidth
+	}
+	windowMax := maxBytes * windowPercent / 100
+	mainMax := maxBytes - windowMax
+	return &TinyLFU{
+		maxBytes:     maxBytes,
+		windowMax:    windowMax,
+		mainMax:      mainMax,
+		protectedMax: mainMax * protectedPercent / 100,
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		cache:        make(map[string]*list.Element),
+		sketch:       newSketch(width),
+		OnEvicted:    onEvicted,
+	}
+}
+
+// Get 函数用于根据键获取缓存中的值，无论是否命中都会记录一次访问频率。
+// 命中 probation 中的记录时将其升级到 protected，命中其他区域的记录时将其移动到所在链表的最前面。
+func (c *TinyLFU) Get(key string) (value Value, ok bool) {
+	c.sketch.increment(key)
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	if kv.expire.Before(time.Now()) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	switch kv.region {
+	case windowRegion:
+		c.window.MoveToFront(ele)
+	case probationRegion:
+		c.detach(ele)
+		c.pushFront(kv, protectedRegion)
+		for c.protectedBytes > c.protectedMax {
+			demoted := c.detach(c.protected.Back())
+			c.pushFront(demoted, probationRegion)
+		}
+	case protectedRegion:
+		c.protected.MoveToFront(ele)
+	}
+	return kv.value, true
+}
+
+// Add 方法用于向缓存中添加新的键值对，键值对在 ttl 之后过期，等价于 AddWithExpire(key, value, time.Now().Add(ttl))。
+func (c *TinyLFU) Add(key string, value Value, ttl time.Duration) {
+	c.AddWithExpire(key, value, time.Now().Add(ttl))
+}
+
+// AddWithExpire 方法用于向缓存中添加新的键值对，键值对在 expireTime 过期。新的记录进入窗口区域，已存在的记录原地更新。
+// 写入不计入访问频率，频率只由 Get 统计。大于 maxBytes 的值不会被缓存，同名的旧值也会被删除。
+func (c *TinyLFU) AddWithExpire(key string, value Value, expireTime time.Time) {
+	kv := &entry{key: key, value: value, expire: expireTime}
+	if c.maxBytes != 0 && kv.size() > c.maxBytes {
+		c.Remove(key)
+		return
+	}
+	if ele, ok := c.cache[key]; ok {
+		old := c.detach(ele) //更新值不算作淘汰，不调用 OnEvicted
+		c.pushFront(kv, old.region)
+	} else {
+		c.pushFront(kv, windowRegion)
+	}
+	c.evict()
+}
+
+// evict 方法将窗口区域中超出容量的记录交给主区域准入，然后保证主区域不超过容量
+func (c *TinyLFU) evict() {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.windowBytes > c.windowMax {
+		c.admit(c.detach(c.window.Back()))
+	}
+	for c.protectedBytes > c.protectedMax {
+		c.pushFront(c.detach(c.protected.Back()), probationRegion)
+	}
+	for c.probationBytes+c.protectedBytes > c.mainMax {
+		c.removeElement(c.victim())
+	}
+}
+
+// admit 方法决定从窗口区域淘汰的候选者能否进入主区域：主区域有空间时直接进入 probation，
+// 否则与受害者比较访问频率，候选者频率更高时淘汰受害者，否则淘汰候选者
+func (c *TinyLFU) admit(candidate *entry) {
+	size := candidate.size()
+	for c.probationBytes+c.protectedBytes+size > c.mainMax {
+		victim := c.victim()
+		if victim == nil || c.sketch.estimate(candidate.key) <= c.sketch.estimate(victim.Value.(*entry).key) {
+			c.evicted(candidate)
+			return
+		}
+		c.removeElement(victim)
+	}
+	c.pushFront(candidate, probationRegion)
+}
+
+// victim 返回主区域中下一个将被淘汰的记录，优先选择 probation 中最久未使用的记录，主区域为空时返回 nil
+func (c *TinyLFU) victim() *list.Element {
+	if ele := c.probation.Back(); ele != nil {
+		return ele
+	}
+	return c.protected.Back()
+}
+
+// Remove 方法用于主动删除某个键，键不存在时什么也不做。
+func (c *TinyLFU) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// Len 方法返回当前缓存中的记录数量。
+func (c *TinyLFU) Len() int {
+	return len(c.cache)
+}
+
+// Bytes 方法返回当前已占用的容量。
+func (c *TinyLFU) Bytes() int64 {
+	return c.nBytes
+}
+
+// Clear 方法清空缓存中的所有记录和访问频率，不会调用 OnEvicted。
+func (c *TinyLFU) Clear() {
+	c.window.Init()
+	c.probation.Init()
+	c.protected.Init()
+	c.cache = make(map[string]*list.Element)
+	c.nBytes, c.windowBytes, c.probationBytes, c.protectedBytes = 0, 0, 0, 0
+	c.sketch.clear()
+}
+
+// list 返回区域对应的链表和已占用容量
+func (c *TinyLFU) list(region int) (*list.List, *int64) {
+	switch region {
+	case probationRegion:
+		return c.probation, &c.probationBytes
+	case protectedRegion:
+		return c.protected, &c.protectedBytes
+	default:
+		return c.window, &c.windowBytes
+	}
+}
+
+// pushFront 将记录放到 region 对应链表的最前面
+func (c *TinyLFU) pushFront(kv *entry, region int) {
+	kv.region = region
+	l, bytes := c.list(region)
+	c.cache[kv.key] = l.PushFront(kv)
+	*bytes += kv.size()
+	c.nBytes += kv.size()
+}
+
+// detach 将节点从所在的链表和 cache 中取出，返回对应的记录，不调用 OnEvicted
+func (c *TinyLFU) detach(ele *list.Element) *entry {
+	kv := ele.Value.(*entry)
+	l, bytes := c.list(kv.region)
+	l.Remove(ele)
+	delete(c.cache, kv.key)
+	*bytes -= kv.size()
+	c.nBytes -= kv.size()
+	return kv
+}
+
+// removeElement 函数用于删除某个节点
+func (c *TinyLFU) removeElement(ele *list.Element) {
+	c.evicted(c.detach(ele))
+}
+
+// evicted 调用记录被移除时的回调函数
+func (c *TinyLFU) evicted(kv *entry) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
@@ -0,0 +1,190 @@
+package tinylfu
+
+import (
+	"Geecache/geecache/lfu"
+	"Geecache/geecache/lru"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key1", String("1234"), time.Minute)
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+	c.AddWithExpire("key3", String("1234"), time.Now().Add(-time.Second))
+	if _, ok := c.Get("key3"); ok || c.Len() != 1 {
+		t.Fatalf("expired key3 should be removed")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key", String("1"), time.Minute)
+	c.Add("key", String("111"), time.Minute)
+	if c.Bytes() != int64(len("key")+len("111")) {
+		t.Fatal("expected 6 but got", c.Bytes())
+	}
+	c.Remove("key")
+	c.Remove("unknown")
+	if c.Len() != 0 || c.Bytes() != 0 {
+		t.Fatalf("Remove key failed")
+	}
+}
+
+// 单个值超过容量时不缓存
+func TestAddTooLarge(t *testing.T) {
+	c := New(int64(10), nil)
+	c.Add("k", String("1"), time.Minute)
+	c.Add("k", String("0123456789"), time.Minute)
+	if _, ok := c.Get("k"); ok || c.Bytes() != 0 {
+		t.Fatalf("value larger than maxBytes should not be cached")
+	}
+}
+
+// 经常被访问的 key 不会被一次性扫描的大量冷 key 挤出缓存
+func TestScanResistance(t *testing.T) {
+	var evicted []string
+	c := New(int64(1000), func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	hot := make([]string, 10)
+	for i := range hot {
+		hot[i] = "hot" + strconv.Itoa(i)
+		c.Add(hot[i], String("0123456789"), time.Minute)
+	}
+	for round := 0; round < 5; round++ {
+		for _, key := range hot {
+			c.Get(key)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		key := "scan" + strconv.Itoa(i)
+		c.Get(key)
+		c.Add(key, String("0123456789"), time.Minute)
+		if c.Bytes() > 1000 {
+			t.Fatalf("nBytes %d should not exceed maxBytes", c.Bytes())
+		}
+	}
+	for _, key := range hot {
+		if _, ok := c.Get(key); !ok {
+			t.Fatalf("hot key %s should survive the scan", key)
+		}
+	}
+	if len(evicted) == 0 || c.Len()+len(evicted) != 1010 {
+		t.Fatalf("every key should be either cached or evicted, got %d cached and %d evicted", c.Len(), len(evicted))
+	}
+}
+
+// 计数次数达到采样数量后计数器减半，过去的热点逐渐冷却
+func TestSketchReset(t *testing.T) {
+	s := newSketch(16)
+	for i := 0; i < 10; i++ {
+		s.increment("old")
+	}
+	if s.estimate("old") != 10 {
+		t.Fatalf("expect frequency 10, but got %d", s.estimate("old"))
+	}
+	for s.additions != 0 && s.estimate("old") >= 10 {
+		s.increment("new" + strconv.Itoa(s.additions))
+	}
+	if f := s.estimate("old"); f > 5+maxCounter/8 {
+		t.Fatalf("frequency of old should be halved, but got %d", f)
+	}
+}
+
+func TestClear(t *testing.T) {
+	c := New(int64(100), nil)
+	c.Add("key1", String("1234"), time.Minute)
+	c.Get("key1")
+	c.Clear()
+	if _, ok := c.Get("key1"); ok || c.Len() != 0 || c.Bytes() != 0 {
+		t.Fatalf("Clear failed")
+	}
+	if !reflect.DeepEqual([]int{c.window.Len(), c.probation.Len(), c.protected.Len()}, []int{0, 0, 0}) {
+		t.Fatalf("all regions should be empty after Clear")
+	}
+}
+
+// cache 是三种淘汰算法的公共方法，用于比较命中率
+type cache interface {
+	Get(key string) (value interface{}, ok bool)
+	Add(key string, value String)
+}
+
+type lruAdapter struct{ c *lru.LRUCache }
+
+func (a lruAdapter) Get(key string) (interface{}, bool) { return a.c.Get(key) }
+func (a lruAdapter) Add(key string, value String)       { a.c.Add(key, value, time.Hour) }
+
+type lfuAdapter struct{ c *lfu.LFUCache }
+
+func (a lfuAdapter) Get(key string) (interface{}, bool) { return a.c.Get(key) }
+func (a lfuAdapter) Add(key string, value String)       { a.c.Add(key, value, time.Hour) }
+
+type tinyLFUAdapter struct{ c *TinyLFU }
+
+func (a tinyLFUAdapter) Get(key string) (interface{}, bool) { return a.c.Get(key) }
+func (a tinyLFUAdapter) Add(key string, value String)       { a.c.Add(key, value, time.Hour) }
+
+/*
+BenchmarkHitRatio 在 Zipf 分布的访问序列上比较 lru、lfu 和 tinylfu 的命中率，通过 b.ReportMetric 报告 hit%。
+keys 是不同 key 的数量，缓存能容纳其中的 1%；s 是 Zipf 分布的参数，越大访问越集中。
+前半段和后半段使用不同的热点（key 的编号整体平移），用于观察过去的热点能否被淘汰。
+运行：go test -run NONE -bench HitRatio ./geecache/tinylfu
+*/
+func BenchmarkHitRatio(b *testing.B) {
+	const keys, accesses = 100000, 200000
+	value := String("0123456789")
+	entryBytes := int64(len("key-00000") + value.Len())
+	caches := []struct {
+		name string
+		new  func(maxBytes int64) cache
+	}{
+		{"lru", func(maxBytes int64) cache { return lruAdapter{lru.New(maxBytes, nil)} }},
+		{"lfu", func(maxBytes int64) cache { return lfuAdapter{lfu.New(maxBytes, nil)} }},
+		{"tinylfu", func(maxBytes int64) cache { return tinyLFUAdapter{New(maxBytes, nil)} }},
+	}
+	for _, s := range []float64{1.01, 1.2} {
+		r := rand.New(rand.NewSource(1))
+		zipf := rand.NewZipf(r, s, 1, keys-1)
+		trace := make([]string, accesses)
+		for i := range trace {
+			k := zipf.Uint64()
+			if i >= accesses/2 {
+				k = (k + keys/2) % keys //后半段更换热点
+			}
+			trace[i] = "key-" + strconv.FormatUint(100000+k, 10)[1:]
+		}
+		for _, c := range caches {
+			b.Run(c.name+"/s="+strconv.FormatFloat(s, 'f', -1, 64), func(b *testing.B) {
+				var hits int
+				for n := 0; n < b.N; n++ {
+					cache := c.new(entryBytes * keys / 100)
+					hits = 0
+					for _, key := range trace {
+						if _, ok := cache.Get(key); ok {
+							hits++
+						} else {
+							cache.Add(key, value)
+						}
+					}
+				}
+				b.ReportMetric(float64(hits)/accesses*100, "hit%")
+			})
+		}
+	}
+}
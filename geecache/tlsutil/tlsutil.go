@@ -0,0 +1,162 @@
+package tlsutil // Package tlsutil 根据 PEM 文件创建节点之间以及访问etcd时使用的 TLS 配置，证书更新后无需重启
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+Config 描述一端的 TLS 配置，包含 4 个字段：
+CertFile 和 KeyFile 是 PEM 格式的证书和私钥，服务端必须设置；客户端设置后会在握手时出示证书，用于双向 TLS（mTLS）。
+CAFile 是 PEM 格式的 CA 证书包，服务端设置后要求客户端出示由这些 CA 签发的证书，即开启双向 TLS；
+客户端用它校验服务端的证书，为空时使用系统的 CA。
+ServerName 是客户端校验服务端证书时使用的名称，为空时使用连接地址中的主机名。
+节点之间通过 IP 地址访问而证书中只有域名时，可以把它设置为证书中的域名。
+证书和私钥文件发生变化后，会在下一次握手时重新加载，已经建立的连接不受影响；CA 证书包只在创建配置时读取一次。
+*/
+type Config struct {
+	CertFile   string
+	KeyFile    string
+	CAFile     string
+	ServerName string
+}
+
+// ServerConfig 返回服务端的 TLS 配置，CAFile 不为空时要求并校验客户端证书
+func (c Config) ServerConfig() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("tlsutil: server requires CertFile and KeyFile")
+	}
+	r, err := newReloader(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+	if c.CAFile != "" {
+		if cfg.ClientCAs, err = loadPool(c.CAFile); err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// ClientConfig 返回客户端的 TLS 配置，CertFile 和 KeyFile 不为空时在服务端要求时出示客户端证书
+func (c Config) ClientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		r, err := newReloader(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = r.getClientCertificate
+	}
+	if c.CAFile != "" {
+		pool, err := loadPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// loadPool 读取 PEM 格式的 CA 证书包
+func loadPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("tlsutil: read CA file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tlsutil: no certificate found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// fileStamp 记录文件的修改时间和大小，任意一个变化都认为文件被更新了
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+func statFile(name string) (fileStamp, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{mod: info.ModTime(), size: info.Size()}, nil
+}
+
+// reloader 持有当前的证书，每次握手时检查证书和私钥文件，发生变化就重新加载
+type reloader struct {
+	certFile, keyFile string
+	mu                sync.Mutex
+	cert              *tls.Certificate
+	certStamp         fileStamp // 当前证书加载时证书文件的状态
+	keyStamp          fileStamp // 当前证书加载时私钥文件的状态
+}
+
+// newReloader 创建 reloader 并立即加载一次证书，文件不存在或格式错误时返回错误
+func newReloader(certFile, keyFile string) (*reloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("tlsutil: CertFile and KeyFile must be set together")
+	}
+	r := &reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.current(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// current 返回最新的证书。文件发生变化但加载失败时（例如证书和私钥只更新了一个），
+// 继续使用旧的证书并在下一次握手时重试，从来没有加载成功时返回错误
+func (r *reloader) current() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	certStamp, err1 := statFile(r.certFile)
+	keyStamp, err2 := statFile(r.keyFile)
+	if err := errors.Join(err1, err2); err != nil {
+		return r.fallback(err)
+	}
+	if r.cert != nil && certStamp == r.certStamp && keyStamp == r.keyStamp {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return r.fallback(err)
+	}
+	if r.cert != nil {
+		log.Printf("[tlsutil] reloaded certificate %s", r.certFile)
+	}
+	r.cert, r.certStamp, r.keyStamp = &cert, certStamp, keyStamp
+	return r.cert, nil
+}
+
+// fallback 在加载失败时返回旧的证书，调用方需要持有 r.mu
+func (r *reloader) fallback(err error) (*tls.Certificate, error) {
+	if r.cert == nil {
+		return nil, fmt.Errorf("tlsutil: load certificate: %v", err)
+	}
+	log.Printf("[tlsutil] reload certificate %s failed, keep the old one: %v", r.certFile, err)
+	return r.cert, nil
+}
+
+func (r *reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current()
+}
+
+func (r *reloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.current()
+}
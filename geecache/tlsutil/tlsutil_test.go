@@ -0,0 +1,151 @@
+package tlsutil
+
+import (
+	"Geecache/geecache/tlsutil/tlstest"
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// handshake 在本地端口上完成一次 TLS 握手，返回客户端看到的服务端证书序列号和服务端看到的客户端证书序列号（没有时为 0）
+func handshake(t *testing.T, server, client *tls.Config) (serverSerial, clientSerial int64, err error) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	done := make(chan error, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		tlsConn := tls.Server(conn, server)
+		if err = tlsConn.Handshake(); err == nil {
+			if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+				clientSerial = certs[0].SerialNumber.Int64()
+			}
+		}
+		done <- err
+	}()
+	conn, err := tls.Dial("tcp", lis.Addr().String(), client)
+	if err == nil {
+		serverSerial = conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+		conn.Read(make([]byte, 1)) //TLS 1.3 中服务端在握手之后才校验客户端证书，等待服务端关闭连接
+		conn.Close()
+	}
+	err = errors.Join(err, <-done) //等待服务端协程写入 clientSerial
+	return serverSerial, clientSerial, err
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := tlstest.NewCA(t)
+	serverSerial, serverCert, serverKey := ca.Issue(t, "server", "127.0.0.1", "cache.local")
+	clientSerial, clientCert, clientKey := ca.Issue(t, "client")
+	server, err := Config{CertFile: serverCert, KeyFile: serverKey, CAFile: ca.CertFile}.ServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, _ := Config{CertFile: clientCert, KeyFile: clientKey, CAFile: ca.CertFile}.ClientConfig()
+	if s, c, err := handshake(t, server, client); err != nil || s != serverSerial || c != clientSerial {
+		t.Fatalf("mutual TLS failed: %d, %d, %v", s, c, err)
+	}
+	client, _ = Config{CertFile: clientCert, KeyFile: clientKey, CAFile: ca.CertFile, ServerName: "cache.local"}.ClientConfig()
+	if _, _, err := handshake(t, server, client); err != nil {
+		t.Fatalf("ServerName in the certificate should be accepted: %v", err)
+	}
+	client, _ = Config{CertFile: clientCert, KeyFile: clientKey, CAFile: ca.CertFile, ServerName: "other.local"}.ClientConfig()
+	if _, _, err := handshake(t, server, client); err == nil {
+		t.Fatalf("ServerName not in the certificate should be rejected")
+	}
+	client, _ = Config{CAFile: ca.CertFile}.ClientConfig()
+	if _, _, err := handshake(t, server, client); err == nil {
+		t.Fatalf("client without certificate should be rejected")
+	}
+
+	other := tlstest.NewCA(t)
+	_, otherCert, otherKey := other.Issue(t, "client")
+	client, _ = Config{CertFile: otherCert, KeyFile: otherKey, CAFile: ca.CertFile}.ClientConfig()
+	if _, _, err := handshake(t, server, client); err == nil {
+		t.Fatalf("client certificate from an unknown CA should be rejected")
+	}
+	client, _ = Config{CertFile: clientCert, KeyFile: clientKey, CAFile: other.CertFile}.ClientConfig()
+	if _, _, err := handshake(t, server, client); err == nil {
+		t.Fatalf("server certificate from an unknown CA should be rejected")
+	}
+
+	server, _ = Config{CertFile: serverCert, KeyFile: serverKey}.ServerConfig() //没有 CAFile 时不要求客户端证书
+	client, _ = Config{CAFile: ca.CertFile}.ClientConfig()
+	if s, c, err := handshake(t, server, client); err != nil || s != serverSerial || c != 0 {
+		t.Fatalf("one-way TLS failed: %d, %d, %v", s, c, err)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	ca := tlstest.NewCA(t)
+	_, cert, key := ca.Issue(t, "server")
+	for name, cfg := range map[string]Config{
+		"no key":       {CertFile: cert},
+		"missing file": {CertFile: cert, KeyFile: key + ".missing"},
+		"swapped":      {CertFile: key, KeyFile: cert},
+		"bad CA":       {CertFile: cert, KeyFile: key, CAFile: key},
+	} {
+		if _, err := cfg.ServerConfig(); err == nil {
+			t.Errorf("%s: ServerConfig should fail", name)
+		}
+		if _, err := cfg.ClientConfig(); err == nil {
+			t.Errorf("%s: ClientConfig should fail", name)
+		}
+	}
+	if _, err := (Config{CAFile: ca.CertFile}).ServerConfig(); err == nil {
+		t.Errorf("server without certificate should fail")
+	}
+}
+
+// 测试证书文件更新后在下一次握手时重新加载，更新到一半时继续使用旧的证书
+func TestReload(t *testing.T) {
+	ca := tlstest.NewCA(t)
+	oldSerial, cert, key := ca.Issue(t, "server", "127.0.0.1")
+	server, err := Config{CertFile: cert, KeyFile: key}.ServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _ := Config{CAFile: ca.CertFile}.ClientConfig()
+	if s, _, err := handshake(t, server, client); err != nil || s != oldSerial {
+		t.Fatalf("expect certificate %d, but got %d, %v", oldSerial, s, err)
+	}
+
+	oldKey, _ := os.ReadFile(key)
+	ca.Issue(t, "server", "127.0.0.1")
+	os.WriteFile(key, oldKey, 0o600) //只有证书更新了，与私钥不匹配
+	touch(t, cert, key)
+	if s, _, err := handshake(t, server, client); err != nil || s != oldSerial {
+		t.Fatalf("mismatched files should keep certificate %d, but got %d, %v", oldSerial, s, err)
+	}
+
+	newSerial, _, _ := ca.Issue(t, "server", "127.0.0.1")
+	touch(t, cert, key)
+	if s, _, err := handshake(t, server, client); err != nil || s != newSerial {
+		t.Fatalf("expect reloaded certificate %d, but got %d, %v", newSerial, s, err)
+	}
+}
+
+var touches int //touch 的调用次数，每次调用设置的修改时间都比上一次晚
+
+// touch 把文件的修改时间推后，保证在时间精度较低的文件系统上也能发现文件的变化
+func touch(t *testing.T, names ...string) {
+	touches++
+	mod := time.Now().Add(time.Duration(touches) * time.Second)
+	for _, name := range names {
+		if err := os.Chtimes(name, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package twoq
+
+import (
+	"container/list"
+	"time"
+)
+
+const (
+	recentPercent = 25 //recent 队列占总容量的百分比，即论文中的 Kin
+	ghostPercent  = 50 //幽灵队列记录的 key 的大小之和占总容量的百分比，即论文中的 Kout
+)
+
+// 记录所在的队列
+const (
+	recent   = iota //A1in：第一次写入的记录，先进先出
+	frequent        //Am：从幽灵队列回来的记录，LRU
+	ghost           //A1out：从 recent 淘汰的幽灵记录，只保留 key 和大小，先进先出
+)
+
+/*
+TwoQueueCache 实现了 2Q 缓存淘汰算法（完整版本），容量按字节计算：
+recent：新写入的记录先进入这个先进先出队列，在队列中被访问不会改变顺序，
+这样短时间内的多次访问（例如一次请求内的重复读取）不会被误认为是热点；
+ghost：幽灵队列，记录最近从 recent 淘汰的 key 和大小，不保存值；
+frequent：被淘汰后又在幽灵队列有效期内再次写入的 key 说明会被反复使用，进入这个 LRU 队列长期保存。
+一次性扫描的大量冷 key 只会经过 recent 和 ghost，不会把 frequent 中的热点 key 挤出缓存。
+recent 超过总容量的 25% 时优先淘汰 recent，否则淘汰 frequent；ghost 中 key 的大小之和不超过总容量的 50%。
+cache：map，键是字符串，值是 recent、frequent 中对应节点的指针；ghosts：map，键是字符串，值是 ghost 中对应节点的指针；
+OnEvicted：是某条真实记录被移除时的回调函数，可以为 nil。
+*/
+type TwoQueueCache struct {
+	maxBytes  int64
+	nBytes    int64
+	recentMax int64
+	ghostMax  int64
+	queues    [3]*list.List
+	bytes     [3]int64
+	cache     map[string]*list.Element
+	ghosts    map[string]*list.Element
+	OnEvicted func(key string, value Value)
+}
+
+type Value interface {
+	Len() int
+} // 为了通用性，我们允许值是实现了 Value 接口的任意类型，该接口只包含了一个方法 Len() int，用于返回值所占用的内存大小。
+
+type entry struct {
+	key    string
+	value  Value     //幽灵记录的值为 nil
+	size   int64     //记录占用的容量，幽灵记录保留被淘汰时的大小
+	expire time.Time //节点的过期时间
+	queue  int       //节点所在的队列
+}
+
+// New 通过传入maxBytes,onEvicted这些参数，返回一个TwoQueueCache结构体。maxBytes 为 0 时不限制容量，也不会淘汰任何记录。
+func New(maxBytes int64, onEvicted func(string, Value)) *TwoQueueCache {
+	c := &TwoQueueCache{
+		maxBytes:  maxBytes,
+		recentMax: maxBytes * recentPercent / 100,
+		ghostMax:  maxBytes * ghostPercent / 100,
+		cache:     make(map[string]*list.Element),
+		ghosts:    make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+	for i := range c.queues {
+		c.queues[i] = list.New()
+	}
+	return c
+}
+
+// Get 函数用于根据键获取缓存中的值。命中 frequent 中的记录时将其移动到队列的最前面，命中 recent 中的记录时不改变顺序；
+// 如果键不存在或者键已经过期，则返回零值和 false。
+func (c *TwoQueueCache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	if kv.expire.Before(time.Now()) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	if kv.queue == frequent {
+		c.queues[frequent].MoveToFront(ele)
+	}
+	return kv.value, true
+}
+
+// Add 方法用于向缓存中添加新的键值对，键值对在 ttl 之后过期，等价于 AddWithExpire(key, value, time.Now().Add(ttl))。
+func (c *TwoQueueCache) Add(key string, value Value, ttl time.Duration) {
+	c.AddWithExpire(key, value, time.Now().Add(ttl))
+}
+
+// AddWithExpire 方法用于向缓存中添加新的键值对，键值对在 expireTime 过期。已存在的记录原地更新，不改变所在的队列；
+// 命中幽灵队列的 key 进入 frequent，其他新的记录进入 recent。大于 maxBytes 的值不会被缓存，同名的旧值也会被删除。
+func (c *TwoQueueCache) AddWithExpire(key string, value Value, expireTime time.Time) {
+	size := int64(len(key)) + int64(value.Len())
+	if c.maxBytes != 0 && size > c.maxBytes {
+		c.Remove(key)
+		return
+	}
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.nBytes += size - kv.size
+		c.bytes[kv.queue] += size - kv.size
+		kv.value, kv.size, kv.expire = value, size, expireTime
+		if kv.queue == frequent {
+			c.queues[frequent].MoveToFront(ele)
+		}
+	} else {
+		kv := &entry{key: key, value: value, size: size, expire: expireTime, queue: recent}
+		if ele, ok := c.ghosts[key]; ok {
+			c.detach(ele)
+			kv.queue = frequent
+		}
+		c.cache[key] = c.queues[kv.queue].PushFront(kv)
+		c.bytes[kv.queue] += size
+		c.nBytes += size
+	}
+	c.reclaim()
+}
+
+// reclaim 方法淘汰真实记录直到不超过容量：recent 超过 recentMax 或者 frequent 为空时淘汰 recent 中最早写入的记录，
+// 被淘汰的 key 进入幽灵队列；否则淘汰 frequent 中最久未使用的记录。最后限制幽灵队列的大小。
+func (c *TwoQueueCache) reclaim() {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.nBytes > c.maxBytes {
+		if c.bytes[recent] > c.recentMax || c.queues[frequent].Len() == 0 {
+			kv := c.detach(c.queues[recent].Back())
+			c.evicted(kv)
+			kv.value, kv.queue = nil, ghost
+			c.ghosts[kv.key] = c.queues[ghost].PushFront(kv)
+			c.bytes[ghost] += kv.size
+		} else {
+			c.removeElement(c.queues[frequent].Back())
+		}
+	}
+	for c.bytes[ghost] > c.ghostMax {
+		c.detach(c.queues[ghost].Back())
+	}
+}
+
+// Remove 方法用于主动删除某个键，同时删除对应的幽灵记录，键不存在时什么也不做。
+func (c *TwoQueueCache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+	if ele, ok := c.ghosts[key]; ok {
+		c.detach(ele)
+	}
+}
+
+// Len 方法返回当前缓存中真实记录的数量，不包括幽灵记录。
+func (c *TwoQueueCache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes 方法返回当前真实记录已占用的容量。
+func (c *TwoQueueCache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Clear 方法清空缓存中的所有记录和幽灵记录，不会调用 OnEvicted。
+func (c *TwoQueueCache) Clear() {
+	for i := range c.queues {
+		c.queues[i].Init()
+		c.bytes[i] = 0
+	}
+	c.cache = make(map[string]*list.Element)
+	c.ghosts = make(map[string]*list.Element)
+	c.nBytes = 0
+}
+
+// detach 将节点从所在的队列和 map 中取出，返回对应的记录，不调用 OnEvicted
+func (c *TwoQueueCache) detach(ele *list.Element) *entry {
+	kv := ele.Value.(*entry)
+	c.queues[kv.queue].Remove(ele)
+	c.bytes[kv.queue] -= kv.size
+	if kv.queue == ghost {
+		delete(c.ghosts, kv.key)
+	} else {
+		delete(c.cache, kv.key)
+		c.nBytes -= kv.size
+	}
+	return kv
+}
+
+// removeElement 函数用于删除某个真实记录，不会留下幽灵记录
+func (c *TwoQueueCache) removeElement(ele *list.Element) {
+	c.evicted(c.detach(ele))
+}
+
+// evicted 调用记录被移除时的回调函数
+func (c *TwoQueueCache) evicted(kv *entry) {
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
@@ -0,0 +1,134 @@
+package twoq
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+// key 和 value 的长度之和为 10，方便计算容量
+func key(i int) string {
+	return fmt.Sprintf("k%03d", i)
+}
+
+var value = String("012345")
+
+func TestGet(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key1", String("1234"), time.Minute)
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+	c.AddWithExpire("key3", String("1234"), time.Now().Add(-time.Second))
+	if _, ok := c.Get("key3"); ok || c.Len() != 1 {
+		t.Fatalf("expired key3 should be removed")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	c := New(int64(0), nil)
+	c.Add("key", String("1"), time.Minute)
+	c.Add("key", String("111"), time.Minute)
+	if c.Bytes() != int64(len("key")+len("111")) {
+		t.Fatal("expected 6 but got", c.Bytes())
+	}
+	c.Remove("key")
+	if c.Len() != 0 || c.Bytes() != 0 {
+		t.Fatalf("Remove key failed")
+	}
+	c = New(int64(10), nil)
+	c.Add("k", String("0123456789"), time.Minute)
+	if _, ok := c.Get("k"); ok || c.Bytes() != 0 {
+		t.Fatalf("value larger than maxBytes should not be cached")
+	}
+}
+
+// recent 是先进先出队列，其中的记录被访问后仍然按写入顺序淘汰，被淘汰的 key 进入幽灵队列
+func TestGhost(t *testing.T) {
+	var evicted []string
+	c := New(int64(100), func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	for i := 0; i < 10; i++ {
+		c.Add(key(i), value, time.Minute)
+	}
+	c.Get(key(0))
+	c.Add(key(10), value, time.Minute)
+	if len(evicted) != 1 || evicted[0] != key(0) {
+		t.Fatalf("k0 should be evicted first, evicted %v", evicted)
+	}
+	if ele := c.ghosts[key(0)]; ele == nil || ele.Value.(*entry).value != nil {
+		t.Fatalf("k0 should be kept in the ghost queue without value")
+	}
+	if _, ok := c.Get(key(0)); ok {
+		t.Fatalf("ghost entry should not be returned")
+	}
+
+	c.Add(key(0), value, time.Minute)
+	if c.cache[key(0)].Value.(*entry).queue != frequent || c.ghosts[key(0)] != nil {
+		t.Fatalf("k0 should move from the ghost queue to frequent")
+	}
+	if c.Len() != 10 || c.Bytes() != 100 {
+		t.Fatalf("unexpected state: len %d, bytes %d", c.Len(), c.Bytes())
+	}
+}
+
+// 幽灵队列中 key 的大小之和不超过总容量的 50%，最早的幽灵记录先被丢弃
+func TestGhostLimit(t *testing.T) {
+	c := New(int64(100), nil)
+	for i := 0; i < 30; i++ {
+		c.Add(key(i), value, time.Minute)
+	}
+	if c.bytes[ghost] != 50 || len(c.ghosts) != 5 {
+		t.Fatalf("ghost queue should be limited to 50 bytes, but got %d", c.bytes[ghost])
+	}
+	c.Add(key(0), value, time.Minute)
+	if c.cache[key(0)].Value.(*entry).queue != recent {
+		t.Fatalf("k0 has been dropped from the ghost queue and should enter recent")
+	}
+}
+
+// 一次性扫描的大量冷 key 只会经过 recent 和幽灵队列，frequent 中的热点 key 不受影响
+func TestScanResistance(t *testing.T) {
+	c := New(int64(100), nil)
+	for i := 0; i < 5; i++ {
+		c.Add(key(i), value, time.Minute)
+	}
+	for i := 5; i < 15; i++ {
+		c.Add(key(i), value, time.Minute) //把 k0 到 k4 挤进幽灵队列
+	}
+	for i := 0; i < 5; i++ {
+		c.Add(key(i), value, time.Minute) //从幽灵队列回来，进入 frequent
+	}
+	for i := 100; i < 1100; i++ {
+		c.Add(key(i), String(value[:len(value)-2]), time.Minute)
+		if c.Bytes() > 100 {
+			t.Fatalf("nBytes %d should not exceed maxBytes", c.Bytes())
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := c.Get(key(i)); !ok {
+			t.Fatalf("hot key %s should survive the scan", key(i))
+		}
+	}
+}
+
+func TestClear(t *testing.T) {
+	c := New(int64(20), nil)
+	for i := 0; i < 3; i++ {
+		c.Add(key(i), value, time.Minute)
+	}
+	c.Clear()
+	if _, ok := c.Get(key(2)); ok || c.Len() != 0 || c.Bytes() != 0 || len(c.ghosts) != 0 {
+		t.Fatalf("Clear failed")
+	}
+}
@@ -0,0 +1,145 @@
+package geecache
+
+import (
+	"Geecache/geecache/lru"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TypedGetterFunc 是 TypedGroup 的数据源，返回类型为 T 的值，由 TypedGroup 负责编码
+type TypedGetterFunc[T any] func(ctx context.Context, key string) (T, error)
+
+/*
+TypedGroup 在 Group 之上提供类型为 T 的读写接口，调用方不需要自己编码和解码：
+group：底层的缓存组，缓存、远程节点和 singleflight 仍然使用编码后的字节；
+codec：类型 T 的编解码器，数据源返回的值在写入缓存前编码一次，从缓存中读出的值解码一次；
+decoded：可选的解码结果缓存，本地命中时如果缓存的字节没有变化就直接返回上一次的解码结果，见 SetDecodedCache；
+mu：保护 decoded。
+*/
+type TypedGroup[T any] struct {
+	group   *Group
+	codec   Codec[T]
+	mu      sync.Mutex
+	decoded *lru.LRUCache
+}
+
+// decodedValue 是 decoded 中保存的解码结果，view 是解码时的缓存值，用于判断缓存值是否已经变化
+type decodedValue[T any] struct {
+	view  ByteView
+	value T
+}
+
+func (d *decodedValue[T]) Len() int {
+	return d.view.Len()
+}
+
+// NewTypedGroup 创建名为 name 的类型化缓存组，getter 返回的值使用 codec 编码后保存，opts 与 NewGroupWithOptions 相同
+func NewTypedGroup[T any](name string, getter TypedGetterFunc[T], codec Codec[T], opts ...GroupOption) (*TypedGroup[T], error) {
+	if getter == nil || codec == nil {
+		return nil, fmt.Errorf("nil getter or codec")
+	}
+	g, err := NewGroupWithOptions(name, GetterCtxFunc(func(ctx context.Context, key string) ([]byte, error) {
+		v, err := getter(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Encode(v)
+	}), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedGroup[T]{group: g, codec: codec}, nil
+}
+
+// Group 返回底层的缓存组，用于注册远程节点、设置软过期等
+func (g *TypedGroup[T]) Group() *Group {
+	return g.group
+}
+
+// SetDecodedCache 开启解码结果缓存，最多保存 maxBytes（按编码后的大小计算）的解码结果，maxBytes 为 0 时关闭，默认关闭。
+// 开启后同一个缓存值被多次读取时只解码一次，不同调用方拿到的是同一个值，调用方不能修改返回值（例如指针、切片和 map 的内容）。
+func (g *TypedGroup[T]) SetDecodedCache(maxBytes int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.decoded = nil
+	if maxBytes > 0 {
+		g.decoded = lru.New(maxBytes, nil)
+	}
+}
+
+// Get 获取 key 对应的值，获取顺序与 Group.GetContext 相同，得到的字节解码后返回
+func (g *TypedGroup[T]) Get(ctx context.Context, key string) (T, error) {
+	var zero T
+	view, err := g.group.GetContext(ctx, key)
+	if err != nil {
+		return zero, err
+	}
+	if v, ok := g.lookup(key, view); ok {
+		return v, nil
+	}
+	v, err := g.codec.Decode(view.b)
+	if err != nil {
+		return zero, fmt.Errorf("decode %s: %w", key, err)
+	}
+	g.store(key, view, v)
+	return v, nil
+}
+
+// Set 编码 v 后写入拥有 key 的节点，参见 Group.Set
+func (g *TypedGroup[T]) Set(key string, v T, ttl time.Duration) error {
+	data, err := g.codec.Encode(v)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", key, err)
+	}
+	return g.group.Set(key, data, ttl)
+}
+
+// Remove 删除 key，参见 Group.Remove
+func (g *TypedGroup[T]) Remove(key string) error {
+	g.mu.Lock()
+	if g.decoded != nil {
+		g.decoded.Remove(key)
+	}
+	g.mu.Unlock()
+	return g.group.Remove(key)
+}
+
+// lookup 在解码结果缓存中查找 key，只有解码时的缓存值与 view 是同一个值时才命中
+func (g *TypedGroup[T]) lookup(key string, view ByteView) (T, bool) {
+	var zero T
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.decoded == nil {
+		return zero, false
+	}
+	v, ok := g.decoded.Get(key)
+	if !ok {
+		return zero, false
+	}
+	d := v.(*decodedValue[T])
+	if !sameView(d.view, view) {
+		return zero, false
+	}
+	return d.value, true
+}
+
+// store 把解码结果放入解码结果缓存，与缓存值同时过期
+func (g *TypedGroup[T]) store(key string, view ByteView, v T) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.decoded == nil || view.e.IsZero() {
+		return
+	}
+	g.decoded.AddWithExpire(key, &decodedValue[T]{view: view, value: v}, view.e)
+}
+
+// sameView 判断两个 ByteView 是否引用同一个缓存值。缓存值写入后不会被修改，更新时总是换成新的切片，
+// 所以底层数组、加载时间和过期时间都相同就说明缓存值没有变化
+func sameView(a, b ByteView) bool {
+	if len(a.b) != len(b.b) || !a.t.Equal(b.t) || !a.e.Equal(b.e) {
+		return false
+	}
+	return len(a.b) == 0 || &a.b[0] == &b.b[0]
+}
@@ -0,0 +1,102 @@
+package geecache
+
+import (
+	pb "Geecache/geecache/geecachepb"
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+type score struct {
+	Name  string
+	Score int
+}
+
+// countingCodec 统计编码和解码的次数
+type countingCodec[T any] struct {
+	Codec[T]
+	encodes, decodes *AtomicInt
+}
+
+func (c countingCodec[T]) Encode(v T) ([]byte, error) {
+	c.encodes.Add(1)
+	return c.Codec.Encode(v)
+}
+
+func (c countingCodec[T]) Decode(data []byte) (T, error) {
+	c.decodes.Add(1)
+	return c.Codec.Decode(data)
+}
+
+func TestCodecs(t *testing.T) {
+	s := score{Name: "Tom", Score: 630}
+	for name, codec := range map[string]Codec[score]{"json": JSONCodec[score]{}, "gob": GobCodec[score]{}} {
+		data, err := codec.Encode(s)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if v, err := codec.Decode(data); err != nil || v != s {
+			t.Fatalf("%s: expect %v, but got %v, %v", name, s, v, err)
+		}
+	}
+	var codec ProtoCodec[*pb.Request]
+	data, err := codec.Encode(&pb.Request{Group: "scores", Key: "Tom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := codec.Decode(data); err != nil || !proto.Equal(v, &pb.Request{Group: "scores", Key: "Tom"}) {
+		t.Fatalf("proto: unexpected %v, %v", v, err)
+	}
+	if _, err := codec.Decode([]byte{0xff}); err == nil {
+		t.Fatalf("invalid proto data should fail to decode")
+	}
+}
+
+func TestTypedGroup(t *testing.T) {
+	var loads, encodes, decodes AtomicInt
+	codec := countingCodec[score]{JSONCodec[score]{}, &encodes, &decodes}
+	gee, err := NewTypedGroup[score]("typed-scores", func(ctx context.Context, key string) (score, error) {
+		loads.Add(1)
+		if key == "unknown" {
+			return score{}, notFound(key)
+		}
+		return score{Name: key, Score: 630}, nil
+	}, codec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gee.Group().Close()
+	for i := 0; i < 3; i++ {
+		if v, err := gee.Get(context.Background(), "Tom"); err != nil || v != (score{"Tom", 630}) {
+			t.Fatalf("unexpected %v, %v", v, err)
+		}
+	}
+	if loads.Get() != 1 || encodes.Get() != 1 || decodes.Get() != 3 {
+		t.Fatalf("expect 1 load, 1 encode and 3 decodes, but got %d, %d, %d", loads.Get(), encodes.Get(), decodes.Get())
+	}
+	if _, err := gee.Get(context.Background(), "unknown"); err == nil {
+		t.Fatalf("getter error should be returned")
+	}
+
+	gee.SetDecodedCache(1 << 10)
+	for i := 0; i < 3; i++ {
+		gee.Get(context.Background(), "Tom")
+	}
+	if decodes.Get() != 4 {
+		t.Fatalf("decoded cache should skip decoding, but decoded %d times", decodes.Get())
+	}
+	if err := gee.Set("Tom", score{"Tom", 700}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := gee.Get(context.Background(), "Tom"); v.Score != 700 || decodes.Get() != 5 {
+		t.Fatalf("new value should be decoded again, but got %v", v)
+	}
+	if err := gee.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := gee.Get(context.Background(), "Tom"); v.Score != 630 || loads.Get() != 3 {
+		t.Fatalf("removed key should be loaded again, but got %v", v)
+	}
+}
@@ -2,10 +2,16 @@ package main
 
 import (
 	"Geecache/geecache"
+	"Geecache/geecache/registry"
+	"Geecache/geecache/tlsutil"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 // db 是伪造的数据源
@@ -16,16 +22,24 @@ var db = map[string]string{
 }
 
 // createGroup 创建并返回一个 geecache 的缓存组（Group 实例）。
-// 该组使用 LRU 策略，并且有一个 Getter 函数，用于从 db 字典中获取数据。
+// 该组使用 LRU 策略，并且有一个 Getter 函数，用于从 db 字典中获取数据，不存在的 key 会被负缓存 5 秒。
 func createGroup() *geecache.Group {
-	return geecache.NewGroup("scores", 2<<10, "lru", geecache.GetterFunc( //lru算法做测试
-		func(key string) ([]byte, error) {
+	gee, err := geecache.NewGroupWithOptions("scores", geecache.GetterCtxFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
 			log.Println("[SlowDB] Search key", key)
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
-		}))
+			return nil, fmt.Errorf("%s not exist: %w", key, geecache.ErrNotFound)
+		}),
+		geecache.WithPolicy("lru"), //lru算法做测试
+		geecache.WithCacheBytes(2<<10),
+		geecache.WithNegativeCache(5*time.Second),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return gee
 }
 
 // startAPIServer 启动一个 API 服务器，用于与用户进行交互。用户可以通过访问 /api?key=XXX 的形式来获取缓存数据。
@@ -33,7 +47,11 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
-			view, err := gee.Get(key)
+			view, err := gee.GetContext(r.Context(), key) //客户端断开时取消后续的远程请求和数据源查询
+			if errors.Is(err, geecache.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -48,8 +66,27 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 func main() {
 	var port int
 	var api bool
+	var weight int
+	var peerTLS, etcdTLS tlsutil.Config
+	var etcdTLSOn bool
+	var etcdEndpoints, prefix string
+	var etcdUser, etcdPassword string
 	flag.IntVar(&port, "port", 8001, "Geecache server port")
+	flag.IntVar(&weight, "weight", 1, "Geecache server weight in the hash ring")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.StringVar(&peerTLS.CertFile, "tls-cert", "", "PEM certificate for peer connections, enables TLS")
+	flag.StringVar(&peerTLS.KeyFile, "tls-key", "", "PEM private key of -tls-cert")
+	flag.StringVar(&peerTLS.CAFile, "tls-ca", "", "PEM CA bundle to verify peers, enables mutual TLS")
+	flag.StringVar(&peerTLS.ServerName, "tls-server-name", "", "Name to verify in peer certificates instead of the peer address")
+	flag.StringVar(&etcdEndpoints, "etcd", "localhost:2379", "Comma separated etcd endpoints")
+	flag.StringVar(&prefix, "prefix", "geecache", "Service prefix in etcd, clusters sharing one etcd use different prefixes")
+	flag.BoolVar(&etcdTLSOn, "etcd-tls", false, "Connect to etcd over TLS, implied by -etcd-tls-ca and -etcd-tls-cert")
+	flag.StringVar(&etcdTLS.CertFile, "etcd-tls-cert", "", "PEM client certificate for etcd, enables TLS")
+	flag.StringVar(&etcdTLS.KeyFile, "etcd-tls-key", "", "PEM private key of -etcd-tls-cert")
+	flag.StringVar(&etcdTLS.CAFile, "etcd-tls-ca", "", "PEM CA bundle to verify etcd, enables TLS, system CAs are used when empty")
+	flag.StringVar(&etcdTLS.ServerName, "etcd-tls-server-name", "", "Name to verify in etcd certificates instead of the endpoint host")
+	flag.StringVar(&etcdUser, "etcd-user", "", "etcd username when authentication is enabled")
+	flag.StringVar(&etcdPassword, "etcd-password", "", "Password of -etcd-user")
 	flag.Parse()
 
 	apiAddr := "http://localhost:9999"
@@ -66,20 +103,43 @@ func main() {
 	if api {
 		go startAPIServer(apiAddr, gee)
 	}
-	startCacheServerGrpcEtcd(addrMap[port], addrs, gee) //grpc版本
+	etcdCfg := registry.Config{
+		Endpoints: strings.Split(etcdEndpoints, ","),
+		Username:  etcdUser,
+		Password:  etcdPassword,
+		Prefix:    prefix,
+	}
+	if etcdTLSOn || etcdTLS.CAFile != "" || etcdTLS.CertFile != "" {
+		tlsCfg, err := etcdTLS.ClientConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		etcdCfg.TLS = tlsCfg
+	}
+	opts := []geecache.ServerOption{
+		geecache.WithWeight(weight),
+		geecache.WithRegistry(etcdCfg),
+	}
+	if peerTLS.CertFile != "" {
+		opts = append(opts, geecache.WithTLS(peerTLS))
+	}
+	startCacheServerGrpcEtcd(addrMap[port], addrs, gee, opts...) //grpc版本
 }
 
 // startCacheServerGrpcEtcd 函数：
-// 创建一个 geecache.Server 实例，该实例用于处理 gRPC 请求并与其他节点通信。
-// 通过 geecache.Server 实例的 Set 方法设置一组节点地址。
+// 创建一个 geecache.Server 实例，该实例用于处理 gRPC 请求并与其他节点通信，opts 中包含节点的权重、TLS 等配置。
+// 通过 geecache.Server 实例的 Set 方法设置一组初始节点地址，启动后以etcd中注册的节点为准。
 // 将 geecache.Server 实例注册到缓存组（gee）中。
 // 启动 geecache.Server 实例，开始处理 gRPC 请求。
-func startCacheServerGrpcEtcd(addr string, addrs []string, gee *geecache.Group) {
-	peers, _ := geecache.NewServer(addr)
+func startCacheServerGrpcEtcd(addr string, addrs []string, gee *geecache.Group, opts ...geecache.ServerOption) {
+	peers, err := geecache.NewServer(addr, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
 	peers.Set(addrs...)
 	gee.RegisterPeers(peers)
 	log.Println("geecache is running at ", addr)
-	err := peers.Start()
+	err = peers.Start()
 	if err != nil {
 		peers.Stop()
 	}